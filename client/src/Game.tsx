@@ -6,6 +6,7 @@ import useWebSocket from './hooks/useWebSocket';
 import { AppColor } from './config';
 import { Loader, Message, Container, Button } from 'semantic-ui-react';
 import { v4 as uuidv4 } from 'uuid';
+import { requestWithCaptcha, trustBrowser } from './captcha';
 type GameProps = {
   appColor: AppColor;
   toaster: Toaster;
@@ -16,31 +17,83 @@ function Game({ setAppColor, appColor, toaster }: GameProps) {
   const isSpectator = query.has('spectate');
   const gameID = query.get('gameID');
   const playerID = query.get('playerID');
+  const [token, setToken] = React.useState(gameID ? window.localStorage.getItem(`token:${gameID}`) : null);
+  const [claimingToken, setClaimingToken] = React.useState(
+    !isSpectator && !token && !!gameID && /^[A-Z]{15}$/.test(playerID ?? ''),
+  );
   const [game, setGame] = React.useState<Game | null>(null);
+  const [expired, setExpired] = React.useState(false);
+  const [trusted, setTrusted] = React.useState(!isSpectator);
+  const [captchaFailed, setCaptchaFailed] = React.useState(false);
   const [sessionID] = React.useState<string>(uuidv4());
   const webSocketHost = window.location.host.includes('localhost') ? 'localhost:8080' : window.location.host;
   const wsProtocol = window.location.protocol.includes('https') ? 'wss' : 'ws';
   const [connected, incomingMessage, sendMessage, reconnect] = useWebSocket({
     webSocketUrl: isSpectator
       ? `${wsProtocol}://${webSocketHost}/ws/spectate?gameID=${gameID}&sessionID=${sessionID}`
-      : `${wsProtocol}://${webSocketHost}/ws?gameID=${gameID}&playerID=${playerID}&sessionID=${sessionID}`,
-    skip: typeof gameID !== 'string' && !isSpectator && playerID !== null,
+      : `${wsProtocol}://${webSocketHost}/ws?gameID=${gameID}&sessionID=${sessionID}`,
+    skip: (typeof gameID !== 'string' && !isSpectator && playerID !== null) || !trusted || claimingToken,
+    token: isSpectator ? null : token,
   });
   React.useEffect(() => {
-    if (incomingMessage !== null) {
+    if (!trusted) {
+      trustBrowser('spectate')
+        .then((ok) => (ok ? setTrusted(true) : setCaptchaFailed(true)))
+        .catch(() => setCaptchaFailed(true));
+    }
+  }, [trusted]);
+  React.useEffect(() => {
+    // Games from before player tokens only put the player ID in the URL, trade it for a token.
+    if (claimingToken && gameID && playerID) {
+      requestWithCaptcha('/game/join', 'POST', { gameID, playerID }, 'join_game')
+        .then((res) => res.json())
+        .then((result) => {
+          if (result?.token) {
+            window.localStorage.setItem(`token:${gameID}`, result.token);
+            setToken(result.token);
+          }
+        })
+        .catch(() => {})
+        .finally(() => setClaimingToken(false));
+    }
+  }, [claimingToken, gameID, playerID]);
+  React.useEffect(() => {
+    if ((incomingMessage as any)?.error === 'game expired') {
+      setExpired(true);
+    } else if (incomingMessage !== null) {
       setGame(incomingMessage);
     }
   }, [incomingMessage]);
   React.useEffect(() => {
     const intervalID = setInterval(() => {
-      if (game && !connected) {
+      if (game && !connected && !expired) {
         reconnect();
       }
     }, 1000);
     return () => {
       clearInterval(intervalID);
     };
-  }, [connected, reconnect, game]);
+  }, [connected, reconnect, game, expired]);
+  if (expired) {
+    return (
+      <Container>
+        <Message warning>
+          <Message.Header>This game has expired</Message.Header>
+          <p>Games that nobody plays for a while are removed. Create a new game to keep playing.</p>
+        </Message>
+      </Container>
+    );
+  }
+  if (captchaFailed) {
+    return (
+      <Container>
+        <Message negative>
+          <Message.Header>We could not tell whether you are a robot</Message.Header>
+          <p>Try refreshing the page.</p>
+        </Message>
+      </Container>
+    );
+  }
   if (typeof gameID !== 'string') {
     return (
       <Container>
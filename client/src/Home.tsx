@@ -29,33 +29,51 @@ function Home() {
   const [joinGameID, setJoinGameID] = React.useState<string | null>(query.get('gameID'));
   const [joinGamePlayerName, setJoinGamePlayerName] = React.useState<string | null>(null);
   const [createGamePlayerName, setCreateGamePlayerName] = React.useState<string | null>(null);
+  const [joinGamePassword, setJoinGamePassword] = React.useState('');
+  const [createGamePassword, setCreateGamePassword] = React.useState('');
   const [shouldCreateGame, setShouldCreateGame] = React.useState(false);
   const [shouldJoinGame, setShouldJoinGame] = React.useState(false);
   const gameIDInParams = query.has('gameID');
   const [createGameLoading, createGameError, createGameResult] = useAPI({
-    endpoint: `/game/create${playingOnThisDevice ? `?playerName=${createGamePlayerName}` : '?'}`,
+    endpoint: '/game/create',
     method: 'POST',
+    body: {
+      playerName: playingOnThisDevice ? createGamePlayerName : '',
+      password: createGamePassword,
+    },
     skip: !shouldCreateGame || (playingOnThisDevice && (createGamePlayerName === null || createGamePlayerName === '')),
-    withReCAPTCHA: true,
+    captchaAction: 'create_game',
   });
   const [joinGameLoading, joinGameError, joinGameResult] = useAPI({
-    endpoint: `/game/join?gameID=${joinGameID}&playerName=${joinGamePlayerName}`,
+    endpoint: '/game/join',
     method: 'POST',
+    body: { gameID: joinGameID, playerName: joinGamePlayerName, password: joinGamePassword },
+    captchaAction: 'join_game',
     skip: !shouldJoinGame || joinGamePlayerName === null || joinGamePlayerName === '' || joinGameGameError,
-    withReCAPTCHA: false,
   });
   React.useEffect(() => {
-    if (joinGameResult?.error === 'GameDoesntExist') {
+    if (joinGameResult?.error?.code === 'GameDoesntExist') {
       setJoinGameGameError('The game could not be found');
-    } else if (joinGameResult?.error === 'NameAlreadyTaken') {
+    } else if (joinGameResult?.error?.code === 'NameAlreadyTaken') {
       setJoinGameGameError('Someone in the game already has that name');
-    } else if (joinGameResult?.error === 'GameIsFull') {
+    } else if (joinGameResult?.error?.code === 'GameIsFull') {
       setJoinGameGameError('That game is already full (8 players)');
-    } else if (joinGameResult?.error === 'GameAlreadyStarted') {
+    } else if (joinGameResult?.error?.code === 'GameAlreadyStarted') {
       setJoinGameGameError('That game has already started');
+    } else if (joinGameResult?.error?.code === 'PasswordRequired') {
+      setJoinGameGameError('That game needs a password');
+    } else if (joinGameResult?.error?.code === 'WrongPassword') {
+      setJoinGameGameError('That password is not right');
+    } else if (joinGameResult?.error?.code === 'TooManyAttempts') {
+      setJoinGameGameError('Too many wrong passwords, try again later');
+    } else if (joinGameResult?.error?.code === 'CaptchaFailed') {
+      setJoinGameGameError('We could not tell whether you are a robot, try again later');
     }
   }, [joinGameResult]);
   if (createGameResult?.id) {
+    if (createGameResult?.token) {
+      window.localStorage.setItem(`token:${createGameResult.id}`, createGameResult.token);
+    }
     history.push(
       `/game?gameID=${createGameResult?.id}${
         !playingOnThisDevice ? '&spectate' : `&playerID=${createGameResult?.playerID}`
@@ -72,6 +90,7 @@ function Home() {
     );
   }
   if (joinGameResult?.success && joinGameResult?.playerID) {
+    window.localStorage.setItem(`token:${joinGameID}`, joinGameResult.token);
     history.push(`/game?gameID=${joinGameID}&playerID=${joinGameResult?.playerID}`);
   } else if (joinGameError) {
     return (
@@ -126,6 +145,16 @@ function Home() {
                   }}
                   error={joinGamePlayerNameFieldRequiredError}
                 />
+                <Form.Input
+                  icon="lock"
+                  iconPosition="left"
+                  label="Room password (if it has one)"
+                  type="password"
+                  value={joinGamePassword}
+                  onChange={(e) => {
+                    setJoinGamePassword(e.target.value);
+                  }}
+                />
                 <Button
                   content="Join game"
                   color="blue"
@@ -170,6 +199,16 @@ function Home() {
                       error={createGamePlayerNameFieldRequiredError}
                       disabled={!playingOnThisDevice}
                     />
+                    <Form.Input
+                      icon="lock"
+                      iconPosition="left"
+                      label={<label style={{ textAlign: 'left' }}>Room password (optional)</label>}
+                      type="password"
+                      value={createGamePassword}
+                      onChange={(e) => {
+                        setCreateGamePassword(e.target.value);
+                      }}
+                    />
                     <Popup
                       content="Disabling this will require you to join the game on a different device."
                       trigger={
@@ -0,0 +1,106 @@
+// Gets bot protection tokens from whichever provider the server is configured with (see /captcha/config).
+
+type CaptchaConfig = {
+  provider: string;
+  siteKey: string;
+};
+
+let configPromise: Promise<CaptchaConfig> | null = null;
+const scripts: { [src: string]: Promise<void> } = {};
+
+function getCaptchaConfig(): Promise<CaptchaConfig> {
+  if (!configPromise) {
+    configPromise = fetch('/captcha/config').then((res) => res.json());
+  }
+  return configPromise;
+}
+
+function loadScript(src: string): Promise<void> {
+  if (!scripts[src]) {
+    scripts[src] = new Promise((resolve, reject) => {
+      const script = document.createElement('script');
+      script.src = src;
+      script.async = true;
+      script.onload = () => resolve();
+      script.onerror = () => reject(new Error(`Could not load ${src}`));
+      document.body.appendChild(script);
+    });
+  }
+  return scripts[src];
+}
+
+// Widgets of the providers that need one are rendered into a hidden element.
+function widgetContainer(): HTMLElement {
+  const container = document.createElement('div');
+  container.style.display = 'none';
+  document.body.appendChild(container);
+  return container;
+}
+
+// getCaptchaToken returns a token for the given action, or '' when the server doesn't check tokens.
+export async function getCaptchaToken(action: string): Promise<string> {
+  const { provider, siteKey } = await getCaptchaConfig();
+  switch (provider) {
+    case 'recaptcha':
+      await loadScript(`https://www.google.com/recaptcha/api.js?render=${siteKey}`);
+      return new Promise((resolve) => {
+        grecaptcha.ready(() => {
+          grecaptcha.execute(siteKey, { action }).then(resolve);
+        });
+      });
+    case 'hcaptcha': {
+      await loadScript('https://js.hcaptcha.com/1/api.js?render=explicit');
+      const widgetID = hcaptcha.render(widgetContainer(), { sitekey: siteKey, size: 'invisible' });
+      const { response } = await hcaptcha.execute(widgetID, { async: true });
+      return response;
+    }
+    case 'turnstile': {
+      await loadScript('https://challenges.cloudflare.com/turnstile/v0/api.js?render=explicit');
+      return new Promise((resolve, reject) => {
+        turnstile.render(widgetContainer(), {
+          sitekey: siteKey,
+          action,
+          callback: resolve,
+          'error-callback': () => reject(new Error('Turnstile failed')),
+        });
+      });
+    }
+    default:
+      return '';
+  }
+}
+
+// requestWithCaptcha sends a JSON request without a captcha token first, since browsers that passed a captcha
+// recently are trusted, and only gets a token for the action when the server asks for one.
+export async function requestWithCaptcha(
+  endpoint: string,
+  method: string,
+  body: object | undefined,
+  action: string,
+): Promise<Response> {
+  const send = (captcha?: string) =>
+    fetch(endpoint, {
+      method,
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(captcha === undefined ? body ?? {} : { ...body, captcha }),
+    });
+  const res = await send();
+  if (res.status !== 400) {
+    return res;
+  }
+  const result = await res
+    .clone()
+    .json()
+    .catch(() => null);
+  if (result?.error?.code !== 'CaptchaRequired') {
+    return res;
+  }
+  return send(await getCaptchaToken(action));
+}
+
+// trustBrowser makes sure the server trusts this browser before it opens a WebSocket, which can't answer a
+// captcha request itself.
+export async function trustBrowser(action: string): Promise<boolean> {
+  const res = await requestWithCaptcha('/captcha/verify', 'POST', { action }, action);
+  return res.ok;
+}
@@ -1,15 +1,19 @@
 import React from 'react';
+import { requestWithCaptcha } from '../captcha';
 
 // based on https://rastating.github.io/creating-a-conditional-react-hook/
 
 type useAPIParams = {
   endpoint: string;
   method: string;
+  body?: object;
   skip: boolean;
-  withReCAPTCHA: boolean;
+  captchaAction?: string;
 };
 
-export default function useAPI({ endpoint, method, skip, withReCAPTCHA = false }: useAPIParams) {
+export default function useAPI({ endpoint, method, body, skip, captchaAction }: useAPIParams) {
+  // Serialized so that a new but equal body object doesn't send the request again.
+  const payload = body ? JSON.stringify(body) : undefined;
   const [result, setResult] = React.useState<any>(null);
   const [loading, setLoading] = React.useState(false);
   const [hasError, setHasError] = React.useState(false);
@@ -21,27 +25,15 @@ export default function useAPI({ endpoint, method, skip, withReCAPTCHA = false }
 
   React.useEffect(() => {
     if (!skip) {
-      const getReCAPTCHAToken = async () => {
-        return new Promise((r) => {
-          grecaptcha?.ready(() => {
-            grecaptcha
-              ?.execute('6LcEX-0UAAAAAPakStenDryOkvRgineD9Sn5Xbqg', { action: 'validate_captcha' })
-              .then((token: string) => {
-                r(token);
-              });
-          });
-        });
-      };
       const executeRequest = async () => {
         try {
-          let additionalParams = '';
-          if (withReCAPTCHA) {
-            const token = await getReCAPTCHAToken();
-            additionalParams = `&recaptcha=${token}`;
-          }
-          const res = await fetch(`${endpoint}${additionalParams}`, {
-            method,
-          });
+          const res = captchaAction
+            ? await requestWithCaptcha(endpoint, method, payload ? JSON.parse(payload) : undefined, captchaAction)
+            : await fetch(endpoint, {
+                method,
+                headers: payload ? { 'Content-Type': 'application/json' } : undefined,
+                body: payload,
+              });
           setResult(await res.json());
         } catch (error) {
           setHasError(true);
@@ -50,7 +42,7 @@ export default function useAPI({ endpoint, method, skip, withReCAPTCHA = false }
       };
       executeRequest();
     }
-  }, [skip, endpoint, method, withReCAPTCHA]);
+  }, [skip, endpoint, method, payload, captchaAction]);
 
   return [loading, hasError, result];
 }
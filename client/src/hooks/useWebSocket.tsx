@@ -3,6 +3,7 @@ import React from 'react';
 type useWebSocketParams = {
   webSocketUrl: string;
   skip: boolean;
+  token?: string | null;
 };
 
 const NORMAL_CLOSURE = 1000;
@@ -10,6 +11,7 @@ const NORMAL_CLOSURE = 1000;
 export default function ({
   webSocketUrl,
   skip,
+  token,
 }: useWebSocketParams): [boolean, Game | null, (message: string) => void, () => void] {
   const [socketUrl] = React.useState(webSocketUrl);
   const [socket, setSocket] = React.useState<WebSocket | null>(null);
@@ -29,6 +31,9 @@ export default function ({
         setSocket(new WebSocket(socketUrl));
       }
       socket?.addEventListener('open', () => {
+        if (token) {
+          socket?.send(JSON.stringify({ Action: 'Authenticate', Token: token }));
+        }
         setConnected(true);
       });
       socket?.addEventListener('message', (e) => {
@@ -44,7 +49,7 @@ export default function ({
     return () => {
       socket?.close(NORMAL_CLOSURE);
     };
-  }, [socketUrl, socket, skip, shouldReconnect]);
+  }, [socketUrl, socket, skip, shouldReconnect, token]);
   React.useEffect(() => {
     const preparedMessage = JSON.stringify(latestSentMessage);
     console.log('sending', preparedMessage);
@@ -1,5 +1,6 @@
 interface Message {
   Action: string;
+  Token?: string;
 }
 
 type CardData = {
@@ -8,6 +9,60 @@ type CardData = {
   Index: number;
 };
 
+type GameEvent = {
+  Seq: number;
+  Type: string;
+  At: number;
+  Actor: string;
+  Player: string;
+  Role: string;
+  Team: string;
+  Word: string;
+  Count: number;
+  BelongsTo: string;
+  Correct: boolean;
+  Target: number;
+  Setting: string;
+};
+
+type UndoProposal = {
+  Word: string;
+  ProposedBy: string;
+  Votes: string[];
+  VotesNeeded: number;
+  ExpiresAt: number;
+};
+
+type PlayerScore = {
+  Name: string;
+  Wins: number;
+  Losses: number;
+  SpyWins: number;
+  SpyLosses: number;
+  GuesserWins: number;
+  GuesserLosses: number;
+  AssassinHits: number;
+};
+
+type Scoreboard = {
+  RedWins: number;
+  BlueWins: number;
+  RedAverageCardsPerTurn: number;
+  BlueAverageCardsPerTurn: number;
+  Players: PlayerScore[];
+};
+
+type OpenGame = {
+  ID: string;
+  Host: string;
+  Players: number;
+  PlayerLimit: number;
+  PasswordProtected: boolean;
+  GuessPolicy: string;
+  RotationPolicy: string;
+  UpdatedAt: number;
+};
+
 type BaseGame = {
   ID: string;
   Status: string;
@@ -23,6 +78,18 @@ type BaseGame = {
   LastCardGuessedBy: string;
   LastCardGuessedCorrectly: boolean;
   Cards: { [x: string]: CardData };
+  Events: GameEvent[];
+  UndoProposal: UndoProposal | null;
+  GuessPolicy: string;
+  RotationPolicy: string;
+  SpyCounts: { [playerName: string]: number };
+  TeamsLocked: boolean;
+  AllowTeamRequests: boolean;
+  TeamRequests: { [playerName: string]: string };
+  Scoreboard: Scoreboard;
+  PasswordProtected: boolean;
+  SpectatorsNeedPassword: boolean;
+  Public: boolean;
 };
 
 type Game = {
@@ -30,6 +97,8 @@ type Game = {
   YouOwnGame: boolean;
   YourTurn: boolean;
   GameCanStart: boolean;
+  TeamVotes: { [playerName: string]: string } | null;
+  TeamSuggestions: { [playerName: string]: string } | null;
   BaseGame: BaseGame;
 };
 
@@ -41,3 +110,5 @@ interface Toaster {
 }
 
 declare var grecaptcha: any;
+declare var hcaptcha: any;
+declare var turnstile: any;
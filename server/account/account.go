@@ -0,0 +1,214 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/db"
+	"github.com/RobertDHanna/OpenCodenames/ids"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionCookie is the name of the cookie holding a logged in player's session token.
+const SessionCookie = "session"
+
+const minPasswordLength = 8
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9_-]{3,24}$`)
+
+// Profile what a player gets to see about their own account
+type Profile struct {
+	Username  string
+	Email     string
+	PlayerID  string
+	CreatedAt int64
+}
+
+// ToProfile hides the password hash of an account.
+func ToProfile(account *db.Account) Profile {
+	return Profile{
+		Username:  account.Username,
+		Email:     account.Email,
+		PlayerID:  account.PlayerID,
+		CreatedAt: account.CreatedAt,
+	}
+}
+
+// newToken returns a random secret handed to the player, only its hash is stored.
+func newToken() (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(bytes)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.Index(email, "@")
+	if at < 1 || at == len(email)-1 || strings.ContainsAny(email, "/ ") {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+func newAccount(username string, email string) (*db.Account, error) {
+	playerID, err := ids.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &db.Account{Username: username, Email: email, PlayerID: playerID, CreatedAt: time.Now().Unix()}, nil
+}
+
+func startSession(ctx context.Context, client *firestore.Client, username string, kind string, ttl time.Duration) (string, error) {
+	token, tokenHash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	session := &db.Session{Username: username, Kind: kind, ExpiresAt: time.Now().Add(ttl).Unix()}
+	if err := db.CreateSession(ctx, client, tokenHash, session); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Register creates an account with a password and logs the player in, returning their session token.
+// The email is optional and lets the player log in with a magic link as well.
+func Register(ctx context.Context, client *firestore.Client, username string, email string, password string) (string, *db.Account, error) {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if !usernamePattern.MatchString(username) {
+		return "", nil, ErrInvalidUsername
+	}
+	if len(password) < minPasswordLength {
+		return "", nil, ErrPasswordTooShort
+	}
+	if email != "" {
+		var err error
+		email, err = normalizeEmail(email)
+		if err != nil {
+			return "", nil, err
+		}
+		// Accounts created before addresses were reserved are only found by searching.
+		if _, err := db.GetAccountByEmail(ctx, client, email); err == nil {
+			return "", nil, ErrEmailAlreadyUsed
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", nil, err
+	}
+	account, err := newAccount(username, email)
+	if err != nil {
+		return "", nil, err
+	}
+	account.PasswordHash = string(hash)
+	if err := db.CreateAccount(ctx, client, account); err != nil {
+		if err == db.ErrEmailAlreadyUsed {
+			return "", nil, ErrEmailAlreadyUsed
+		}
+		return "", nil, err
+	}
+	token, err := startSession(ctx, client, account.Username, db.SessionLogin, config.SessionTTL())
+	if err != nil {
+		return "", nil, err
+	}
+	return token, account, nil
+}
+
+// Login checks a username and password and returns a new session token.
+func Login(ctx context.Context, client *firestore.Client, username string, password string) (string, *db.Account, error) {
+	account, err := db.GetAccount(ctx, client, strings.ToLower(strings.TrimSpace(username)))
+	if err != nil {
+		if err == db.ErrAccountDoesntExist {
+			return "", nil, ErrInvalidCredentials
+		}
+		return "", nil, err
+	}
+	if account.PasswordHash == "" ||
+		bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+	token, err := startSession(ctx, client, account.Username, db.SessionLogin, config.SessionTTL())
+	if err != nil {
+		return "", nil, err
+	}
+	return token, account, nil
+}
+
+// SendMagicLink mails a single use login link to the given address. Nothing is sent to addresses without an account,
+// without telling the caller, so nobody can find out which addresses have one or get mail sent to strangers.
+func SendMagicLink(ctx context.Context, client *firestore.Client, mailer Mailer, email string, baseURL string) error {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return err
+	}
+	account, err := db.GetAccountByEmail(ctx, client, email)
+	if err == db.ErrAccountDoesntExist {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token, err := startSession(ctx, client, account.Username, db.SessionMagicLink, config.MagicLinkTTL())
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/account/verify?token=%s", strings.TrimRight(baseURL, "/"), token)
+	body := fmt.Sprintf("Follow this link to log in to OpenCodenames:\r\n\r\n%s\r\n\r\nIt expires in %s.", link, config.MagicLinkTTL())
+	return mailer.Send(email, "Your OpenCodenames login link", body)
+}
+
+// FinishMagicLink exchanges the token of a magic link for a session token. Each link works once.
+func FinishMagicLink(ctx context.Context, client *firestore.Client, token string) (string, *db.Account, error) {
+	session, err := db.TakeSession(ctx, client, hashToken(token))
+	if err != nil || session.Kind != db.SessionMagicLink || session.ExpiresAt < time.Now().Unix() {
+		return "", nil, ErrInvalidLink
+	}
+	account, err := db.GetAccount(ctx, client, session.Username)
+	if err != nil {
+		return "", nil, err
+	}
+	sessionToken, err := startSession(ctx, client, account.Username, db.SessionLogin, config.SessionTTL())
+	if err != nil {
+		return "", nil, err
+	}
+	return sessionToken, account, nil
+}
+
+// Authenticate returns the account a session token belongs to.
+func Authenticate(ctx context.Context, client *firestore.Client, token string) (*db.Account, error) {
+	session, err := db.GetSession(ctx, client, hashToken(token))
+	if err != nil || session.Kind != db.SessionLogin || session.ExpiresAt < time.Now().Unix() {
+		return nil, ErrNotLoggedIn
+	}
+	return db.GetAccount(ctx, client, session.Username)
+}
+
+// Logout ends the session of a token.
+func Logout(ctx context.Context, client *firestore.Client, token string) error {
+	return db.DeleteSession(ctx, client, hashToken(token))
+}
+
+// FromRequest returns the account of the player making the request, if they are logged in.
+func FromRequest(ctx context.Context, client *firestore.Client, r *http.Request) (*db.Account, error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil, ErrNotLoggedIn
+	}
+	return Authenticate(ctx, client, cookie.Value)
+}
@@ -0,0 +1,14 @@
+package account
+
+import "errors"
+
+// Errors returned by the account package. Their messages double as the error codes sent to clients.
+var (
+	ErrInvalidUsername    = errors.New("InvalidUsername")
+	ErrInvalidEmail       = errors.New("InvalidEmail")
+	ErrPasswordTooShort   = errors.New("PasswordTooShort")
+	ErrEmailAlreadyUsed   = errors.New("EmailAlreadyUsed")
+	ErrInvalidCredentials = errors.New("InvalidCredentials")
+	ErrInvalidLink        = errors.New("InvalidLink")
+	ErrNotLoggedIn        = errors.New("NotLoggedIn")
+)
@@ -0,0 +1,31 @@
+package account
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Mailer delivers emails to players, e.g. their login links.
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// FileMailer writes every email to a file in Dir instead of sending it. Useful when running locally.
+type FileMailer struct {
+	Dir string
+}
+
+// Send writes the email to a new file named after the time and recipient.
+func (m FileMailer) Send(to string, subject string, body string) error {
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+	recipient := strings.NewReplacer("/", "_", "\\", "_").Replace(to)
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), recipient)
+	message := fmt.Sprintf("To: %s\r\nSubject: %s\r\n\r\n%s\r\n", to, subject, body)
+	return ioutil.WriteFile(filepath.Join(m.Dir, name), []byte(message), 0600)
+}
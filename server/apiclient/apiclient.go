@@ -0,0 +1,287 @@
+// Package apiclient is a small client for the HTTP and WebSocket APIs of an OpenCodenames server, meant
+// for bots and integration tests. The APIs themselves are described in api/openapi.yaml and
+// api/asyncapi.yaml.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/RobertDHanna/OpenCodenames/account"
+	g "github.com/RobertDHanna/OpenCodenames/game"
+)
+
+// Client talks to one server. Its HTTPClient keeps the session cookie, so a Client that logged in makes
+// every later request as that account.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New creates a client for the server at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{BaseURL: strings.TrimRight(baseURL, "/"), HTTPClient: &http.Client{Jar: jar}}
+}
+
+// Error a request the server refused. Code is one of the error codes listed in api/openapi.yaml.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// CreateGameRequest what to create a game with. Without a PlayerName the creator only spectates.
+type CreateGameRequest struct {
+	PlayerName        string `json:"playerName,omitempty"`
+	Password          string `json:"password,omitempty"`
+	ProtectSpectators bool   `json:"protectSpectators,omitempty"`
+	Public            bool   `json:"public,omitempty"`
+	Captcha           string `json:"captcha"`
+}
+
+// CreateGameResponse the game that was created
+type CreateGameResponse struct {
+	ID       string `json:"id"`
+	PlayerID string `json:"playerID"`
+	Token    string `json:"token"`
+}
+
+// JoinGameRequest which game to join and as whom
+type JoinGameRequest struct {
+	GameID     string `json:"gameID"`
+	PlayerName string `json:"playerName"`
+	Password   string `json:"password,omitempty"`
+	Captcha    string `json:"captcha,omitempty"`
+}
+
+// QuickJoinRequest who wants to be put in a public game
+type QuickJoinRequest struct {
+	PlayerName string `json:"playerName"`
+	Captcha    string `json:"captcha"`
+}
+
+// JoinGameResponse the player that joined. ID is only set by QuickJoin.
+type JoinGameResponse struct {
+	Success  bool   `json:"success"`
+	ID       string `json:"id"`
+	PlayerID string `json:"playerID"`
+	Token    string `json:"token"`
+}
+
+// do sends a request with body encoded as JSON, if any, and decodes the response into out, if any.
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+	return c.doWithHeader(ctx, method, path, query, nil, body, out)
+}
+
+// doWithHeader is do with extra request headers, e.g. the Authorization header of a player.
+func (c *Client) doWithHeader(ctx context.Context, method string, path string, query url.Values, header http.Header, body interface{}, out interface{}) error {
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		var envelope struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&envelope); err != nil {
+			return &Error{Status: res.StatusCode, Code: "InternalError", Message: res.Status}
+		}
+		return &Error{Status: res.StatusCode, Code: envelope.Error.Code, Message: envelope.Error.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// CreateGame creates a game.
+func (c *Client) CreateGame(ctx context.Context, req CreateGameRequest) (*CreateGameResponse, error) {
+	var res CreateGameResponse
+	if err := c.do(ctx, http.MethodPost, "/game/create", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// JoinGame adds a player to a game.
+func (c *Client) JoinGame(ctx context.Context, req JoinGameRequest) (*JoinGameResponse, error) {
+	var res JoinGameResponse
+	if err := c.do(ctx, http.MethodPost, "/game/join", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// QuickJoin puts a player in the best public game, or in a new one.
+func (c *Client) QuickJoin(ctx context.Context, req QuickJoinRequest) (*JoinGameResponse, error) {
+	var res JoinGameResponse
+	if err := c.do(ctx, http.MethodPost, "/game/quickjoin", nil, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Verify passes a captcha, after which the server trusts the client for a while and doesn't ask it for another
+// one. Spectating needs it unless the token is sent with every connection.
+func (c *Client) Verify(ctx context.Context, captcha string) error {
+	return c.do(ctx, http.MethodPost, "/captcha/verify", nil, map[string]string{"captcha": captcha, "action": "spectate"}, nil)
+}
+
+// ListGames returns the public games waiting for players.
+func (c *Client) ListGames(ctx context.Context) ([]g.OpenGame, error) {
+	var games []g.OpenGame
+	if err := c.do(ctx, http.MethodGet, "/game/list", nil, nil, &games); err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+// Game returns the game as the player the token was issued for sees it.
+func (c *Client) Game(ctx context.Context, gameID string, token string) (*g.PlayerGame, error) {
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	var game g.PlayerGame
+	if err := c.doWithHeader(ctx, http.MethodGet, "/game/"+url.PathEscape(gameID), nil, header, nil, &game); err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// SpectatorGame returns the game as spectators see it. password is only needed for games whose spectators need it. The
+// client has to pass a captcha with Verify first.
+func (c *Client) SpectatorGame(ctx context.Context, gameID string, password string) (*g.BaseGame, error) {
+	query := url.Values{}
+	if password != "" {
+		query.Set("password", password)
+	}
+	var game g.BaseGame
+	if err := c.do(ctx, http.MethodGet, "/game/"+url.PathEscape(gameID), query, nil, &game); err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// ExportRound returns a finished round of a game. Passing 0 returns the latest one. password is only needed for
+// games whose spectators need it. The client has to pass a captcha with Verify first.
+func (c *Client) ExportRound(ctx context.Context, gameID string, round int, password string) (*g.Export, error) {
+	query := url.Values{"gameID": {gameID}}
+	if round > 0 {
+		query.Set("round", strconv.Itoa(round))
+	}
+	if password != "" {
+		query.Set("password", password)
+	}
+	var export g.Export
+	if err := c.do(ctx, http.MethodGet, "/game/export", query, nil, &export); err != nil {
+		return nil, err
+	}
+	return &export, nil
+}
+
+// PlayerStats returns the career stats of the player the token was issued for. Passing "" returns the stats of the
+// logged in player.
+func (c *Client) PlayerStats(ctx context.Context, token string) (*g.CareerStats, error) {
+	var header http.Header
+	if token != "" {
+		header = http.Header{"Authorization": {"Bearer " + token}}
+	}
+	var stats g.CareerStats
+	if err := c.doWithHeader(ctx, http.MethodGet, "/player/stats", nil, header, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Leaderboard ranks the players of a game by their career stats. Players pass their token, everyone else passes ""
+// and has to pass a captcha with Verify first, and the password of games whose spectators need it.
+func (c *Client) Leaderboard(ctx context.Context, gameID string, token string, password string) ([]g.CareerStats, error) {
+	query := url.Values{"gameID": {gameID}}
+	var header http.Header
+	if token != "" {
+		header = http.Header{"Authorization": {"Bearer " + token}}
+	} else if password != "" {
+		query.Set("password", password)
+	}
+	var leaderboard []g.CareerStats
+	if err := c.doWithHeader(ctx, http.MethodGet, "/player/leaderboard", query, header, nil, &leaderboard); err != nil {
+		return nil, err
+	}
+	return leaderboard, nil
+}
+
+// Register creates an account and logs the client in. captcha may be "" after passing one with Verify.
+func (c *Client) Register(ctx context.Context, username string, email string, password string, captcha string) (*account.Profile, error) {
+	body := map[string]string{"username": username, "email": email, "password": password, "captcha": captcha}
+	var profile account.Profile
+	if err := c.do(ctx, http.MethodPost, "/account/register", nil, body, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Login logs the client in with a password.
+func (c *Client) Login(ctx context.Context, username string, password string) (*account.Profile, error) {
+	body := map[string]string{"username": username, "password": password}
+	var profile account.Profile
+	if err := c.do(ctx, http.MethodPost, "/account/login", nil, body, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// Logout ends the client's session.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/account/logout", nil, nil, nil)
+}
+
+// SendMagicLink emails a login link to the given address, if it belongs to an account.
+func (c *Client) SendMagicLink(ctx context.Context, email string) error {
+	return c.do(ctx, http.MethodPost, "/account/magiclink", nil, map[string]string{"email": email}, nil)
+}
+
+// Profile returns the account the client is logged in as.
+func (c *Client) Profile(ctx context.Context) (*account.Profile, error) {
+	var profile account.Profile
+	if err := c.do(ctx, http.MethodGet, "/account/me", nil, nil, &profile); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
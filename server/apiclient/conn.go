@@ -0,0 +1,133 @@
+package apiclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/gorilla/websocket"
+)
+
+// Conn a WebSocket connection to a game. It receives full games, delta updates aren't supported.
+type Conn struct {
+	ws *websocket.Conn
+}
+
+// ConnError the reason the server gave for closing a connection, e.g. "access denied" or "game expired".
+type ConnError struct {
+	Reason string
+}
+
+func (e *ConnError) Error() string {
+	return "connection closed by server: " + e.Reason
+}
+
+// wsURL turns the client's base URL into the address of a WebSocket endpoint.
+func (c *Client) wsURL(path string, query url.Values) (string, error) {
+	u, err := url.Parse(c.BaseURL + path)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func (c *Client) dial(ctx context.Context, path string, query url.Values, header http.Header) (*Conn, error) {
+	endpoint, err := c.wsURL(path, query)
+	if err != nil {
+		return nil, err
+	}
+	dialer := websocket.Dialer{Jar: c.HTTPClient.Jar}
+	ws, _, err := dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{ws: ws}, nil
+}
+
+// Play connects to a game as the player the token was issued for. sessionID tells the server which of
+// the player's connections this is, connecting again with the same one replaces the old connection.
+func (c *Client) Play(ctx context.Context, gameID string, sessionID string, token string) (*Conn, error) {
+	header := http.Header{"Authorization": {"Bearer " + token}}
+	return c.dial(ctx, "/ws", url.Values{"gameID": {gameID}, "sessionID": {sessionID}}, header)
+}
+
+// Spectate connects to a game as a spectator. password is only needed for games whose spectators need it, it is
+// sent in the first message rather than in the URL. The client has to pass a captcha with Verify first.
+func (c *Client) Spectate(ctx context.Context, gameID string, sessionID string, password string) (*Conn, error) {
+	conn, err := c.dial(ctx, "/ws/spectate", url.Values{"gameID": {gameID}, "sessionID": {sessionID}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if password != "" {
+		if err := conn.ws.WriteJSON(map[string]string{"Action": "Authenticate", "Password": password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Next waits for the next game the server sends. It returns a *ConnError when the server closed the
+// connection on purpose.
+func (c *Conn) Next() (*g.PlayerGame, error) {
+	_, message, err := c.ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	var serverError struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(message, &serverError); err == nil && serverError.Error != "" {
+		return nil, &ConnError{Reason: serverError.Error}
+	}
+	var game g.PlayerGame
+	if err := json.Unmarshal(message, &game); err != nil {
+		return nil, err
+	}
+	return &game, nil
+}
+
+// Send sends an action such as "StartGame" or "Clue ocean 2". The actions are listed in api/asyncapi.yaml.
+func (c *Conn) Send(action string) error {
+	return c.ws.WriteJSON(struct{ Action string }{Action: action})
+}
+
+// StartGame starts the game. Only the host can start it.
+func (c *Conn) StartGame() error {
+	return c.Send("StartGame")
+}
+
+// Clue gives a clue to the guessers of the spy's team.
+func (c *Conn) Clue(word string, count int) error {
+	if strings.ContainsAny(word, " \t") {
+		return errors.New("a clue is a single word")
+	}
+	return c.Send(fmt.Sprintf("Clue %s %d", word, count))
+}
+
+// Guess guesses a card.
+func (c *Conn) Guess(word string) error {
+	return c.Send("Guess " + word)
+}
+
+// EndTurn stops guessing for this turn.
+func (c *Conn) EndTurn() error {
+	return c.Send("EndTurn")
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.ws.Close()
+}
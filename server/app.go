@@ -11,8 +11,14 @@ import (
 
 	"cloud.google.com/go/firestore"
 	firebase "firebase.google.com/go"
+	"github.com/RobertDHanna/OpenCodenames/account"
+	"github.com/RobertDHanna/OpenCodenames/captcha"
+	"github.com/RobertDHanna/OpenCodenames/config"
 	"github.com/RobertDHanna/OpenCodenames/handlers"
 	"github.com/RobertDHanna/OpenCodenames/hub"
+	"github.com/RobertDHanna/OpenCodenames/ids"
+	"github.com/RobertDHanna/OpenCodenames/janitor"
+	"github.com/RobertDHanna/OpenCodenames/utils"
 	"google.golang.org/api/option"
 )
 
@@ -32,7 +38,11 @@ func initFirestore() (*firestore.Client, error) {
 }
 
 func main() {
-	rand.Seed(time.Now().Unix())
+	seed, err := ids.Seed()
+	if err != nil {
+		log.Fatalf("Failed seeding math/rand: %v", err)
+	}
+	rand.Seed(seed)
 	client, err := initFirestore()
 	if err != nil {
 		log.Fatalf("Failed initializing Firestore: %v", err)
@@ -54,15 +64,38 @@ func main() {
 	hub := hub.NewHub(client)
 	go hub.Run()
 	go hub.ListenToGames()
+	go janitor.Run(client)
 	fs := http.FileServer(http.Dir("./static-assets"))
 	http.Handle("/", fs)
-	http.HandleFunc("/game/create", handlers.CreateGameHandler(client))
-	http.HandleFunc("/game/join", handlers.JoinGameHandler(client))
+	http.Handle("/api/", http.StripPrefix("/api/", http.FileServer(http.Dir("./api"))))
+	verifier, err := captcha.FromConfig()
+	if err != nil {
+		log.Fatalf("Failed setting up bot protection (set CAPTCHA_PROVIDER=none to run without it): %v", err)
+	}
+	gameIDs := ids.NewAllocator(hub.ActiveGames)
+	http.HandleFunc("/captcha/config", handlers.CaptchaConfigHandler())
+	http.HandleFunc("/captcha/verify", handlers.CaptchaVerifyHandler(verifier))
+	http.HandleFunc("/game/create", handlers.LimitGameCreation(handlers.CreateGameHandler(client, gameIDs, verifier)))
+	http.HandleFunc("/game/join", handlers.JoinGameHandler(client, verifier))
+	http.HandleFunc("/game/list", handlers.ListGamesHandler(client))
+	http.HandleFunc("/game/quickjoin", handlers.LimitGameCreation(handlers.QuickJoinHandler(client, gameIDs, verifier)))
+	http.HandleFunc("/game/export", handlers.ExportGameHandler(client, verifier))
+	http.HandleFunc("/game/", handlers.GameStateHandler(client, verifier))
+	http.HandleFunc("/player/stats", handlers.PlayerStatsHandler(client))
+	http.HandleFunc("/player/leaderboard", handlers.LeaderboardHandler(client, verifier))
+	mailer := account.FileMailer{Dir: config.MailDir()}
+	http.HandleFunc("/account/register", handlers.LimitRegistrations(handlers.RegisterHandler(client, verifier)))
+	http.HandleFunc("/account/login", handlers.LimitLogins(handlers.LoginHandler(client)))
+	http.HandleFunc("/account/logout", handlers.LogoutHandler(client))
+	http.HandleFunc("/account/magiclink", handlers.MagicLinkHandler(client, mailer))
+	http.HandleFunc("/account/verify", handlers.VerifyMagicLinkHandler(client))
+	http.HandleFunc("/account/me", handlers.ProfileHandler(client))
 	http.HandleFunc("/ws", handlers.PlayerHandler(client, hub))
-	http.HandleFunc("/ws/spectate", handlers.SpectatorHandler(client, hub))
+	http.HandleFunc("/ws/spectate", handlers.SpectatorHandler(client, hub, verifier))
+	http.HandleFunc("/ws/replay", handlers.ReplayHandler(client, verifier))
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), nil))
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", port), utils.CORS(http.DefaultServeMux)))
 }
@@ -0,0 +1,123 @@
+// Package captcha checks the tokens browsers get from a bot protection provider before they may create games.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/data"
+)
+
+// Providers a Verifier can be created for.
+const (
+	ProviderReCAPTCHA = "recaptcha"
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+	ProviderNone      = "none"
+	ProviderFake      = "fake"
+)
+
+// Errors returned when a token doesn't pass.
+var (
+	ErrMissingToken = errors.New("CaptchaRequired")
+	ErrFailed       = errors.New("CaptchaFailed")
+)
+
+// Verifier checks a token a browser got from a bot protection provider. action names what the browser was doing,
+// e.g. "create_game", for the providers that can tell whether the token was issued for it.
+type Verifier interface {
+	Verify(ctx context.Context, token string, remoteIP string, action string) error
+}
+
+// New returns the Verifier of the given provider.
+func New(provider string, secret string, minScore float64) (Verifier, error) {
+	switch provider {
+	case ProviderReCAPTCHA:
+		return &ReCAPTCHA{Secret: secret, MinScore: minScore}, nil
+	case ProviderHCaptcha:
+		return &HCaptcha{Secret: secret}, nil
+	case ProviderTurnstile:
+		return &Turnstile{Secret: secret}, nil
+	case ProviderNone:
+		return Noop{}, nil
+	case ProviderFake:
+		return Fake{Token: secret}, nil
+	}
+	return nil, fmt.Errorf("unknown captcha provider %q", provider)
+}
+
+// FromConfig returns the Verifier chosen by the configuration. Without CAPTCHA_SECRET reCAPTCHA falls back to the
+// secret in ./recaptcha-key.txt and the fake accepts "pass".
+func FromConfig() (Verifier, error) {
+	provider, secret := config.CaptchaProvider(), config.CaptchaSecret()
+	if secret == "" && provider == ProviderReCAPTCHA {
+		key, err := data.GetReCAPTCHAKey()
+		if err != nil {
+			return nil, fmt.Errorf("no reCAPTCHA secret: %v", err)
+		}
+		secret = key
+	}
+	if secret == "" && provider == ProviderFake {
+		secret = "pass"
+	}
+	if secret == "" && provider != ProviderNone {
+		return nil, fmt.Errorf("CAPTCHA_SECRET is required for %s", provider)
+	}
+	return New(provider, secret, config.CaptchaMinScore())
+}
+
+// siteVerifyResponse the answer of a provider's siteverify endpoint. reCAPTCHA, hCaptcha and Turnstile all
+// answer with a subset of these fields.
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	Score      float64  `json:"score"`
+	Action     string   `json:"action"`
+	Hostname   string   `json:"hostname"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// siteVerify posts a token to a provider's siteverify endpoint.
+func siteVerify(ctx context.Context, endpoint string, secret string, token string, remoteIP string) (*siteVerifyResponse, error) {
+	form := url.Values{"secret": {secret}, "response": {token}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	var response siteVerifyResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// check turns a siteverify answer into ErrFailed unless it is a success for the expected action.
+func check(provider string, response *siteVerifyResponse, action string) error {
+	if !response.Success {
+		log.Printf("%s: token refused %v", provider, response.ErrorCodes)
+		return ErrFailed
+	}
+	if action != "" && response.Action != "" && response.Action != action {
+		log.Printf("%s: token was issued for %q instead of %q", provider, response.Action, action)
+		return ErrFailed
+	}
+	return nil
+}
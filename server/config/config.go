@@ -1,6 +1,234 @@
 package config
 
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
 // PlayerLimit returns the number of players allowed in a game
 func PlayerLimit() int {
 	return 8
 }
+
+// UndoWindow returns how long after a guess players can still undo it
+func UndoWindow() time.Duration {
+	return 30 * time.Second
+}
+
+// SessionTTL returns how long a player stays logged in to their account
+func SessionTTL() time.Duration {
+	return 30 * 24 * time.Hour
+}
+
+// MagicLinkTTL returns how long a login link sent by email can be used
+func MagicLinkTTL() time.Duration {
+	return 15 * time.Minute
+}
+
+// MailDir returns the directory mail is written to when no mail server is configured
+func MailDir() string {
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return dir
+	}
+	return "./mail"
+}
+
+// MagicLinksPerIP returns how many login links an IP may ask for per MagicLinkWindow
+func MagicLinksPerIP() int {
+	return 10
+}
+
+// MagicLinksPerEmail returns how many login links may be sent to one address per MagicLinkWindow
+func MagicLinksPerEmail() int {
+	return 3
+}
+
+// MagicLinkWindow returns how long it takes to earn back all the login links that may be asked for
+func MagicLinkWindow() time.Duration {
+	return time.Hour
+}
+
+// LoginsPerIP returns how many times an IP may try to log in per LoginWindow
+func LoginsPerIP() int {
+	return 10
+}
+
+// LoginWindow returns how long it takes an IP to earn back all its login attempts
+func LoginWindow() time.Duration {
+	return 10 * time.Minute
+}
+
+// RegistrationsPerIP returns how many accounts an IP may create per RegistrationWindow
+func RegistrationsPerIP() int {
+	return 5
+}
+
+// RegistrationWindow returns how long it takes an IP to earn back all the accounts it may create
+func RegistrationWindow() time.Duration {
+	return time.Hour
+}
+
+// TokenTTL returns how long the token a player gets when creating or joining a game stays valid
+func TokenTTL() time.Duration {
+	return 7 * 24 * time.Hour
+}
+
+// TrustTTL returns how long a browser that passed a captcha isn't asked for another one
+func TrustTTL() time.Duration {
+	return 24 * time.Hour
+}
+
+// PasswordAttempts returns how many wrong room passwords an IP may send per PasswordAttemptWindow
+func PasswordAttempts() int {
+	return 5
+}
+
+// PasswordAttemptWindow returns how long wrong room passwords count against an IP
+func PasswordAttemptWindow() time.Duration {
+	return 10 * time.Minute
+}
+
+// RecentMoves returns how many of the latest clues and guesses are sent along with a game
+func RecentMoves() int {
+	return 20
+}
+
+// EventLogLimit returns how many events a game keeps in its history, older ones are folded into its checkpoint so
+// the game stays well below Firestore's document size limit
+func EventLogLimit() int {
+	return 500
+}
+
+// GamesPerIP returns how many games an IP may create per GamesPerIPWindow
+func GamesPerIP() int {
+	return 10
+}
+
+// GamesPerIPWindow returns how long it takes an IP to earn back all the games it may create
+func GamesPerIPWindow() time.Duration {
+	return 10 * time.Minute
+}
+
+// JoinsPerGame returns how many times an IP may try to join a game per JoinsPerGameWindow
+func JoinsPerGame() int {
+	return 30
+}
+
+// JoinsPerGameWindow returns how long it takes an IP to earn back all its join attempts for a game
+func JoinsPerGameWindow() time.Duration {
+	return time.Minute
+}
+
+// ActionsPerSecond returns how many actions a WebSocket client may send per second
+func ActionsPerSecond() int {
+	return 5
+}
+
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+// TrustedProxies returns the proxies whose X-Forwarded-For header is believed, read once from TRUSTED_PROXIES, see
+// ParseProxies. It is asked on every request, so the list is only parsed the first time.
+func TrustedProxies() []*net.IPNet {
+	trustedProxiesOnce.Do(func() {
+		trustedProxies = ParseProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+	return trustedProxies
+}
+
+// ParseProxies parses a comma separated list of IPs and CIDRs (e.g. "10.0.0.0/8"). Entries that don't parse are
+// ignored.
+func ParseProxies(list string) []*net.IPNet {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			proxies = append(proxies, network)
+		}
+	}
+	return proxies
+}
+
+// AllowedOrigins returns the origins of the sites whose pages may call the API and open WebSockets besides the
+// server's own, read from ALLOWED_ORIGINS as a comma separated list (e.g. "https://codenames.example.com").
+// "*" allows every site, which is meant for development.
+func AllowedOrigins() []string {
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// GameTTL returns how long a game can go without any change before the janitor removes it.
+// It is read from GAME_TTL (e.g. "48h") and defaults to a day.
+func GameTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("GAME_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return 24 * time.Hour
+}
+
+// JanitorInterval returns how often the janitor looks for idle games
+func JanitorInterval() time.Duration {
+	return 10 * time.Minute
+}
+
+// ArchiveExpiredGames returns whether idle games are moved to the "archivedGames" collection (ARCHIVE_GAMES=true)
+// instead of being deleted
+func ArchiveExpiredGames() bool {
+	return os.Getenv("ARCHIVE_GAMES") == "true"
+}
+
+// CaptchaProvider returns which bot protection checks new games: "recaptcha" (the default), "hcaptcha", "turnstile",
+// "none" to turn it off, or "fake" to accept only the token in CAPTCHA_SECRET (for tests and bots). It is read from
+// CAPTCHA_PROVIDER.
+func CaptchaProvider() string {
+	if provider := os.Getenv("CAPTCHA_PROVIDER"); provider != "" {
+		return provider
+	}
+	return "recaptcha"
+}
+
+// CaptchaSecret returns the secret key of the bot protection provider, read from CAPTCHA_SECRET
+func CaptchaSecret() string {
+	return os.Getenv("CAPTCHA_SECRET")
+}
+
+// CaptchaSiteKey returns the public key browsers use to get a token from the bot protection provider, read from
+// CAPTCHA_SITE_KEY
+func CaptchaSiteKey() string {
+	if siteKey := os.Getenv("CAPTCHA_SITE_KEY"); siteKey != "" {
+		return siteKey
+	}
+	if CaptchaProvider() == "recaptcha" {
+		return "6LcEX-0UAAAAAPakStenDryOkvRgineD9Sn5Xbqg"
+	}
+	return ""
+}
+
+// CaptchaMinScore returns the lowest reCAPTCHA v3 score that passes, read from CAPTCHA_MIN_SCORE
+func CaptchaMinScore() float64 {
+	if score, err := strconv.ParseFloat(os.Getenv("CAPTCHA_MIN_SCORE"), 64); err == nil && score >= 0 && score <= 1 {
+		return score
+	}
+	return 0.1
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 	"sync"
 )
 
@@ -16,6 +17,7 @@ var (
 	recaptchaKeyOnce sync.Once
 	instance         WordList
 	recaptchaKey     string
+	recaptchaKeyErr  error
 )
 
 // GetWordList returns the word list
@@ -39,14 +41,11 @@ func GetWordList() WordList {
 	return instance
 }
 
-// GetReCAPTCHAKey returns the token necessary to check ReCAPTCHA tests
-func GetReCAPTCHAKey() string {
+// GetReCAPTCHAKey returns the secret necessary to check ReCAPTCHA tests, read from ./recaptcha-key.txt
+func GetReCAPTCHAKey() (string, error) {
 	recaptchaKeyOnce.Do(func() {
 		key, err := ioutil.ReadFile("./recaptcha-key.txt")
-		if err != nil {
-			log.Fatal(err)
-		}
-		recaptchaKey = string(key)
+		recaptchaKey, recaptchaKeyErr = strings.TrimSpace(string(key)), err
 	})
-	return recaptchaKey
+	return recaptchaKey, recaptchaKeyErr
 }
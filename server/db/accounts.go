@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Session kinds.
+const (
+	// SessionLogin is a logged in browser
+	SessionLogin = "login"
+	// SessionMagicLink is a single use link mailed to the owner of an account
+	SessionMagicLink = "magiclink"
+)
+
+// Account a player that can be recognized across games and devices.
+type Account struct {
+	Username     string `firestore:"username"`
+	Email        string `firestore:"email"`
+	PasswordHash string `firestore:"passwordHash"`
+	PlayerID     string `firestore:"playerID"`
+	CreatedAt    int64  `firestore:"createdAt"`
+}
+
+// Session ties a secret token to an account. Sessions are stored under a hash of the token.
+type Session struct {
+	Username  string `firestore:"username"`
+	Kind      string `firestore:"kind"`
+	ExpiresAt int64  `firestore:"expiresAt"`
+}
+
+// emailReservation claims an email address for an account. It is stored under the normalized address, so two
+// accounts can't be created with the same one even at the same time.
+type emailReservation struct {
+	Username string `firestore:"username"`
+}
+
+// CreateAccount stores a new account, failing if the username or the email address is already used.
+func CreateAccount(ctx context.Context, client *firestore.Client, account *Account) error {
+	ref := client.Collection("accounts").Doc(account.Username)
+	var emailRef *firestore.DocumentRef
+	if account.Email != "" {
+		emailRef = client.Collection("emails").Doc(account.Email)
+	}
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if doc != nil && doc.Exists() {
+			return ErrUsernameAlreadyTaken
+		}
+		if emailRef != nil {
+			doc, err := tx.Get(emailRef)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			}
+			if doc != nil && doc.Exists() {
+				return ErrEmailAlreadyUsed
+			}
+			if err := tx.Create(emailRef, emailReservation{Username: account.Username}); err != nil {
+				return err
+			}
+		}
+		return tx.Create(ref, account)
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		// Another transaction created the account or reserved the address first.
+		err = ErrUsernameAlreadyTaken
+		if emailRef != nil {
+			if doc, getErr := emailRef.Get(ctx); getErr == nil && doc.Exists() {
+				err = ErrEmailAlreadyUsed
+			}
+		}
+	}
+	if err != nil && err != ErrUsernameAlreadyTaken && err != ErrEmailAlreadyUsed {
+		log.Printf("CreateAccount: An error has occurred: %s", err)
+	}
+	return err
+}
+
+// GetAccount returns the account with the given username.
+func GetAccount(ctx context.Context, client *firestore.Client, username string) (*Account, error) {
+	doc, err := client.Collection("accounts").Doc(username).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrAccountDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	var account Account
+	if err := doc.DataTo(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// GetAccountByEmail returns the account registered with the given email address.
+func GetAccountByEmail(ctx context.Context, client *firestore.Client, email string) (*Account, error) {
+	iter := client.Collection("accounts").Where("email", "==", email).Limit(1).Documents(ctx)
+	defer iter.Stop()
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return nil, ErrAccountDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	var account Account
+	if err := doc.DataTo(&account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// CreateSession stores a session under the hash of its token.
+func CreateSession(ctx context.Context, client *firestore.Client, tokenHash string, session *Session) error {
+	_, err := client.Collection("sessions").Doc(tokenHash).Set(ctx, session)
+	if err != nil {
+		log.Printf("CreateSession: An error has occurred: %s", err)
+	}
+	return err
+}
+
+// GetSession returns the session stored under the hash of a token.
+func GetSession(ctx context.Context, client *firestore.Client, tokenHash string) (*Session, error) {
+	doc, err := client.Collection("sessions").Doc(tokenHash).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrSessionDoesntExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := doc.DataTo(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// TakeSession deletes the session stored under the hash of a token and returns it, so it can only be used once.
+func TakeSession(ctx context.Context, client *firestore.Client, tokenHash string) (*Session, error) {
+	ref := client.Collection("sessions").Doc(tokenHash)
+	var session Session
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if status.Code(err) == codes.NotFound {
+			return ErrSessionDoesntExist
+		}
+		if err != nil {
+			return err
+		}
+		if err := doc.DataTo(&session); err != nil {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteSession removes the session stored under the hash of a token.
+func DeleteSession(ctx context.Context, client *firestore.Client, tokenHash string) error {
+	_, err := client.Collection("sessions").Doc(tokenHash).Delete(ctx)
+	return err
+}
+
+// DeleteExpiredSessions removes up to count sessions and magic links that expired before the given unix time and
+// returns how many it removed.
+func DeleteExpiredSessions(ctx context.Context, client *firestore.Client, before int64, count int) (int, error) {
+	docs, err := client.Collection("sessions").Where("expiresAt", "<", before).Limit(count).Documents(ctx).GetAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	batch := client.Batch()
+	for _, doc := range docs {
+		batch.Delete(doc.Ref)
+	}
+	if _, err := batch.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return len(docs), nil
+}
@@ -2,7 +2,6 @@ package db
 
 import (
 	"context"
-	"errors"
 	"log"
 	"time"
 
@@ -19,6 +18,102 @@ type Card struct {
 	Guessed   bool   `firestore:"guessed"`
 }
 
+// Event types recorded in a game's history.
+const (
+	EventJoin              = "join"
+	EventTeamChange        = "teamchange"
+	EventStart             = "start"
+	EventClue              = "clue"
+	EventGuess             = "guess"
+	EventEndTurn           = "endturn"
+	EventWin               = "win"
+	EventRestart           = "restart"
+	EventUndoPropose       = "undoproposed"
+	EventUndoVote          = "undovote"
+	EventUndoReject        = "undorejected"
+	EventUndo              = "undo"
+	EventGuessPolicy       = "guesspolicy"
+	EventGuessVote         = "guessvote"
+	EventRotation          = "rotationpolicy"
+	EventLineup            = "lineup"
+	EventTeamLock          = "teamlock"
+	EventTeamRequest       = "teamrequest"
+	EventTeamDeny          = "teamrequestdenied"
+	EventAllowTeamRequests = "allowteamrequests"
+	EventScoreboardReset   = "scoreboardreset"
+	EventPassword          = "password"
+	EventVisibility        = "visibility"
+)
+
+// Event represents a single state transition in a game's history.
+type Event struct {
+	Seq          int64           `firestore:"seq"`
+	Type         string          `firestore:"type"`
+	At           int64           `firestore:"at"`
+	ActorID      string          `firestore:"actorID"`
+	Actor        string          `firestore:"actor"`
+	Player       string          `firestore:"player"`
+	Role         string          `firestore:"role"`
+	Team         string          `firestore:"team"`
+	Word         string          `firestore:"word"`
+	Count        int             `firestore:"count"`
+	BelongsTo    string          `firestore:"belongsTo"`
+	Correct      bool            `firestore:"correct"`
+	Cards        map[string]Card `firestore:"cards"`
+	Target       int64           `firestore:"target"`
+	Setting      string          `firestore:"setting"`
+	Lineup       *Lineup         `firestore:"lineup"`
+	PasswordHash string          `firestore:"passwordHash,omitempty"` // never leaves the server
+}
+
+// Lineup represents the team and role of every player.
+type Lineup struct {
+	TeamRed         map[string]string `firestore:"teamRed"`
+	TeamBlue        map[string]string `firestore:"teamBlue"`
+	TeamRedSpy      string            `firestore:"teamRedSpy"`
+	TeamBlueSpy     string            `firestore:"teamBlueSpy"`
+	TeamRedGuesser  string            `firestore:"teamRedGuesser"`
+	TeamBlueGuesser string            `firestore:"teamBlueGuesser"`
+}
+
+// UndoProposal represents a request to undo the last guess that is waiting for approval.
+type UndoProposal struct {
+	Target     int64             `firestore:"target"`
+	Word       string            `firestore:"word"`
+	ProposedAt int64             `firestore:"proposedAt"`
+	ProposedBy string            `firestore:"proposedBy"`
+	Votes      map[string]string `firestore:"votes"`
+}
+
+// Decider inspects the current state of a game and returns the events an action produces.
+type Decider func(game *Game) ([]Event, error)
+
+// Reducer returns the game that results from applying event to game without modifying game.
+type Reducer func(game *Game, event Event) (*Game, error)
+
+// PlayerScore represents how a player has done in the rounds played in a game.
+type PlayerScore struct {
+	Name          string `firestore:"name"`
+	Wins          int    `firestore:"wins"`
+	Losses        int    `firestore:"losses"`
+	SpyWins       int    `firestore:"spyWins"`
+	SpyLosses     int    `firestore:"spyLosses"`
+	GuesserWins   int    `firestore:"guesserWins"`
+	GuesserLosses int    `firestore:"guesserLosses"`
+	AssassinHits  int    `firestore:"assassinHits"`
+}
+
+// Scoreboard represents the running tally of the rounds played in a game.
+type Scoreboard struct {
+	RedWins          int                    `firestore:"redWins"`
+	BlueWins         int                    `firestore:"blueWins"`
+	RedTurns         int                    `firestore:"redTurns"`
+	BlueTurns        int                    `firestore:"blueTurns"`
+	RedCardsGuessed  int                    `firestore:"redCardsGuessed"`
+	BlueCardsGuessed int                    `firestore:"blueCardsGuessed"`
+	Players          map[string]PlayerScore `firestore:"players"`
+}
+
 // Game represents a codenames game.
 type Game struct {
 	ID                       string            `firestore:"id"`
@@ -38,123 +133,175 @@ type Game struct {
 	LastCardGuessedCorrectly bool              `firestore:"lastCardGuessedCorrectly"`
 	UpdatedAt                int64             `firestore:"updatedAt"`
 	TimesPlayed              int64             `firestore:"timesPlayed"`
+	Version                  int64             `firestore:"version"`
+	Events                   []Event           `firestore:"events"`
+	UndoProposal             *UndoProposal     `firestore:"undoProposal"`
+	GuessPolicy              string            `firestore:"guessPolicy"`
+	TeamRedVotes             map[string]string `firestore:"teamRedVotes"`
+	TeamBlueVotes            map[string]string `firestore:"teamBlueVotes"`
+	RotationPolicy           string            `firestore:"rotationPolicy"`
+	SpyCounts                map[string]int    `firestore:"spyCounts"`
+	TeamsLocked              bool              `firestore:"teamsLocked"`
+	AllowTeamRequests        bool              `firestore:"allowTeamRequests"`
+	TeamRequests             map[string]string `firestore:"teamRequests"`
+	Scoreboard               Scoreboard        `firestore:"scoreboard"`
+	PasswordHash             string            `firestore:"passwordHash"`
+	SpectatorsNeedPassword   bool              `firestore:"spectatorsNeedPassword"`
+	Public                   bool              `firestore:"public"`
+	PlayerCount              int               `firestore:"playerCount"` // len(Players), kept so games can be queried by it
+	Rounds                   int               `firestore:"rounds"`      // rounds started, kept so rounds keep their numbers
+	Checkpoint               *Game             `firestore:"checkpoint"`  // the game before Events[0], nil for games older than the log
 }
 
-// UpdateGame updates a game using a caller-provided mapOfUpdates.
-func UpdateGame(ctx context.Context, client *firestore.Client, gameID string, mapOfUpdates map[string]interface{}) error {
-	ref := client.Collection("games").Doc(gameID)
-	fieldsToUpdate := []firestore.Update{}
+// appendEvents stamps events with their position in the log and returns the new log. Positions count from the
+// first event the game ever had, so they keep growing once older events were folded into the checkpoint.
+func appendEvents(history []Event, events []Event) []Event {
 	now := time.Now()
-	mapOfUpdates["updatedAt"] = now.Unix()
-	for key, value := range mapOfUpdates {
-		fieldsToUpdate = append(fieldsToUpdate, firestore.Update{Path: key, Value: value})
+	newLog := make([]Event, 0, len(history)+len(events))
+	newLog = append(newLog, history...)
+	seq := int64(len(history))
+	if len(history) > 0 && history[len(history)-1].Seq > seq {
+		seq = history[len(history)-1].Seq
 	}
-	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		return tx.Update(ref, fieldsToUpdate)
-	})
-	if err != nil {
-		log.Printf("UpdateGame: An error has occurred: %s", err)
+	for _, event := range events {
+		seq++
+		event.Seq = seq
+		if event.At == 0 {
+			event.At = now.UnixNano() / int64(time.Millisecond)
+		}
+		newLog = append(newLog, event)
 	}
-	return err
+	return newLog
 }
 
-// CreateGame Creates a game or returns an error if one already exists
-func CreateGame(ctx context.Context, client *firestore.Client, game *Game) error {
-	ref := client.Collection("games").Doc(game.ID)
-	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
-		doc, err := tx.Get(ref)
-		if err != nil && status.Code(err) != codes.NotFound {
-			return err
+// Applied returns the events of a log that still take effect. An undo takes back every event from its target up to
+// itself, so the state after it is the state before its target: both the undo and those events are left out, and
+// the rest can be folded one by one without looking anything up in the log.
+func Applied(events []Event) []Event {
+	undone := map[int64]bool{}
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Type != EventUndo || undone[events[i].Seq] {
+			continue
 		}
-		if doc != nil && doc.Exists() {
-			return errors.New("GameAlreadyExists")
+		for j := i; j >= 0 && events[j].Seq >= events[i].Target; j-- {
+			undone[events[j].Seq] = true
 		}
-		now := time.Now()
-		game.UpdatedAt = now.Unix()
-		return tx.Set(ref, game)
-	})
-	if err != nil {
-		log.Printf("CreateGame: An error has occurred: %s", err)
 	}
-	return err
+	applied := make([]Event, 0, len(events))
+	for _, event := range events {
+		if !undone[event.Seq] {
+			applied = append(applied, event)
+		}
+	}
+	return applied
 }
 
-// AddPlayerToGame Adds a player to a game if it still pending. It also attempts to set a role for the given player.
-func AddPlayerToGame(ctx context.Context, client *firestore.Client, gameID string, playerID string, playerName string) error {
+// Compact drops the oldest events once the log is longer than limit, folding them into the checkpoint so the game can
+// still be rebuilt from it. It cuts right before a start event when it can, so the rounds left in the log are whole,
+// and never between an undo and its target, so every undo left in the log can still be replayed.
+func Compact(game *Game, limit int, reduce Reducer) (*Game, error) {
+	if len(game.Events) <= limit || game.Checkpoint == nil {
+		return game, nil
+	}
+	cut := len(game.Events) - limit
+	for i := cut; i < len(game.Events); i++ {
+		if game.Events[i].Type == EventStart {
+			cut = i
+			break
+		}
+	}
+	for i := len(game.Events) - 1; i >= cut; i-- {
+		if game.Events[i].Type != EventUndo {
+			continue
+		}
+		for cut > 0 && game.Events[cut-1].Seq >= game.Events[i].Target {
+			cut--
+		}
+	}
+	if cut == 0 {
+		return game, nil
+	}
+	checkpoint := game.Checkpoint
+	for _, event := range Applied(game.Events[:cut]) {
+		next, err := reduce(checkpoint, event)
+		if err != nil {
+			return nil, err
+		}
+		checkpoint = next
+	}
+	checkpoint.Events = nil
+	checkpoint.Checkpoint = nil
+	game.Checkpoint = checkpoint
+	game.Events = append([]Event{}, game.Events[cut:]...)
+	return game, nil
+}
+
+// CommitEvents atomically runs decide against the stored game, folds the resulting events into it with
+// reduce, appends them to the game's history and stores the resulting game. Once the history is longer than
+// config.EventLogLimit its oldest events are folded into the game's checkpoint.
+func CommitEvents(ctx context.Context, client *firestore.Client, gameID string, decide Decider, reduce Reducer) error {
 	ref := client.Collection("games").Doc(gameID)
 	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
 		doc, err := tx.Get(ref)
-		if err != nil && status.Code(err) != codes.NotFound {
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return ErrGameDoesntExist
+			}
 			return err
 		}
-		if doc != nil && !doc.Exists() {
-			return errors.New("GameDoesntExist")
-		}
 		var game Game
 		if err := doc.DataTo(&game); err != nil {
 			return err
 		}
-		if _, playerFound := game.Players[playerID]; playerFound {
-			if game.Status == "pending" {
-				// Overwrite player name
-				game.Players[playerID] = playerName
-				return tx.Set(ref, map[string]interface{}{
-					"players": game.Players,
-				}, firestore.MergeAll)
-			}
-			return errors.New("PlayerAlreadyAdded")
+		events, err := decide(&game)
+		if err != nil {
+			return err
 		}
-		for _, otherPlayerName := range game.Players {
-			if playerName == otherPlayerName {
-				return errors.New("NameAlreadyTaken")
-			}
+		if len(events) == 0 {
+			return nil
 		}
-		if len(game.Players) >= config.PlayerLimit() {
-			return errors.New("GameIsFull")
-		}
-		if game.Status != "pending" {
-			return errors.New("GameAlreadyStarted")
-		}
-		fieldsToUpdate := map[string]interface{}{}
-		if len(game.Players) == 0 {
-			fieldsToUpdate["creatorID"] = playerID
-			fieldsToUpdate["teamBlueSpy"] = playerName
-			game.TeamBlue[playerID] = playerName
-			fieldsToUpdate["teamBlue"] = game.TeamBlue
-		} else {
-			// Try to put player on a team and in a role...
-			if game.TeamBlueSpy == "" {
-				fieldsToUpdate["teamBlueSpy"] = playerName
-				game.TeamBlue[playerID] = playerName
-				fieldsToUpdate["teamBlue"] = game.TeamBlue
-			} else if game.TeamBlueGuesser == "" {
-				fieldsToUpdate["teamBlueGuesser"] = playerName
-				game.TeamBlue[playerID] = playerName
-				fieldsToUpdate["teamBlue"] = game.TeamBlue
-			} else if game.TeamRedSpy == "" {
-				fieldsToUpdate["teamRedSpy"] = playerName
-				game.TeamRed[playerID] = playerName
-				fieldsToUpdate["teamRed"] = game.TeamRed
-			} else if game.TeamRedGuesser == "" {
-				fieldsToUpdate["teamRedGuesser"] = playerName
-				game.TeamRed[playerID] = playerName
-				fieldsToUpdate["teamRed"] = game.TeamRed
-			} else if len(game.TeamBlue) < len(game.TeamRed) {
-				game.TeamBlue[playerID] = playerName
-				fieldsToUpdate["teamBlue"] = game.TeamBlue
-			} else {
-				game.TeamRed[playerID] = playerName
-				fieldsToUpdate["teamRed"] = game.TeamRed
+		next := &game
+		for _, event := range appendEvents(game.Events, events)[len(game.Events):] {
+			next, err = reduce(next, event)
+			if err != nil {
+				return err
 			}
+			next.Events = append(next.Events, event)
+		}
+		next, err = Compact(next, config.EventLogLimit(), reduce)
+		if err != nil {
+			return err
 		}
-		game.Players[playerID] = playerName
-		fieldsToUpdate["players"] = game.Players
 		now := time.Now()
-		fieldsToUpdate["updatedAt"] = now.Unix()
-		return tx.Set(ref, fieldsToUpdate, firestore.MergeAll)
+		next.UpdatedAt = now.Unix()
+		next.Version = game.Version + 1
+		return tx.Set(ref, next)
 	})
 	if err != nil {
-		log.Printf("JoinGame: An error has occurred: %s", err)
+		log.Printf("CommitEvents: An error has occurred: %s", err)
+	}
+	return err
+}
+
+// CreateGame Creates a game or returns an error if one already exists
+func CreateGame(ctx context.Context, client *firestore.Client, game *Game) error {
+	ref := client.Collection("games").Doc(game.ID)
+	err := client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if doc != nil && doc.Exists() {
+			return ErrGameAlreadyExists
+		}
+		now := time.Now()
+		game.UpdatedAt = now.Unix()
+		game.Version = 1
+		game.Events = appendEvents(nil, game.Events)
+		return tx.Set(ref, game)
+	})
+	if err != nil {
+		log.Printf("CreateGame: An error has occurred: %s", err)
 	}
 	return err
 }
@@ -162,6 +309,9 @@ func AddPlayerToGame(ctx context.Context, client *firestore.Client, gameID strin
 // GetGame Returns a Game struct.
 func GetGame(ctx context.Context, client *firestore.Client, gameID string) (*Game, error) {
 	doc, err := client.Collection("games").Doc(gameID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, ErrGameDoesntExist
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -176,3 +326,69 @@ func GetGame(ctx context.Context, client *firestore.Client, gameID string) (*Gam
 func ListenToGames(ctx context.Context, client *firestore.Client) *firestore.QuerySnapshotIterator {
 	return client.Collection("games").Snapshots(ctx)
 }
+
+// ListOpenGames returns public games that are waiting for players and have room for more, fullest first.
+func ListOpenGames(ctx context.Context, client *firestore.Client, playerLimit int, count int) ([]*Game, error) {
+	iter := client.Collection("games").
+		Where("public", "==", true).
+		Where("status", "==", "pending").
+		Where("playerCount", "<", playerLimit).
+		OrderBy("playerCount", firestore.Desc).
+		Limit(count).
+		Documents(ctx)
+	docs, err := iter.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	games := make([]*Game, 0, len(docs))
+	for _, doc := range docs {
+		var game Game
+		if err := doc.DataTo(&game); err != nil {
+			return nil, err
+		}
+		games = append(games, &game)
+	}
+	return games, nil
+}
+
+// ListIdleGames returns the IDs of games that haven't changed since before the given unix time.
+func ListIdleGames(ctx context.Context, client *firestore.Client, before int64, count int) ([]string, error) {
+	iter := client.Collection("games").Where("updatedAt", "<", before).Limit(count).Documents(ctx)
+	docs, err := iter.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	gameIDs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		gameIDs = append(gameIDs, doc.Ref.ID)
+	}
+	return gameIDs, nil
+}
+
+// ExpireGame removes a game that is still idle since before the given unix time, copying it to the
+// "archivedGames" collection first when archive is set. Games that changed in the meantime are kept.
+func ExpireGame(ctx context.Context, client *firestore.Client, gameID string, before int64, archive bool) error {
+	ref := client.Collection("games").Doc(gameID)
+	return client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return nil
+			}
+			return err
+		}
+		var game Game
+		if err := doc.DataTo(&game); err != nil {
+			return err
+		}
+		if game.UpdatedAt >= before {
+			return ErrGameNotIdle
+		}
+		if archive {
+			if err := tx.Set(client.Collection("archivedGames").Doc(gameID), &game); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(ref)
+	})
+}
@@ -0,0 +1,31 @@
+package db
+
+import "testing"
+
+func TestAppendEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		history []Event
+		want    []int64
+	}{
+		{"new game", nil, []int64{1, 2}},
+		{"whole log", []Event{{Seq: 1}, {Seq: 2}}, []int64{1, 2, 3, 4}},
+		{"compacted log", []Event{{Seq: 41}, {Seq: 42}}, []int64{41, 42, 43, 44}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log := appendEvents(test.history, []Event{{Type: EventClue}, {Type: EventEndTurn}})
+			if len(log) != len(test.want) {
+				t.Fatalf("%d events, want %d", len(log), len(test.want))
+			}
+			for i, event := range log {
+				if event.Seq != test.want[i] {
+					t.Errorf("event %d has seq %d, want %d", i, event.Seq, test.want[i])
+				}
+			}
+			if log[len(log)-1].At == 0 {
+				t.Error("new events aren't timestamped")
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package db
+
+import "errors"
+
+// Errors returned by the db package. Their messages double as the error codes sent to clients.
+var (
+	ErrGameDoesntExist      = errors.New("GameDoesntExist")
+	ErrGameAlreadyExists    = errors.New("GameAlreadyExists")
+	ErrGameNotIdle          = errors.New("GameNotIdle")
+	ErrAccountDoesntExist   = errors.New("AccountDoesntExist")
+	ErrSessionDoesntExist   = errors.New("SessionDoesntExist")
+	ErrUsernameAlreadyTaken = errors.New("UsernameAlreadyTaken")
+	ErrEmailAlreadyUsed     = errors.New("EmailAlreadyUsed")
+)
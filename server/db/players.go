@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// PlayerStats lifetime totals of a player across every game they finished.
+type PlayerStats struct {
+	Name           string `firestore:"name"`
+	GamesPlayed    int    `firestore:"gamesPlayed"`
+	Wins           int    `firestore:"wins"`
+	SpyGames       int    `firestore:"spyGames"`
+	SpyWins        int    `firestore:"spyWins"`
+	GuesserGames   int    `firestore:"guesserGames"`
+	GuesserWins    int    `firestore:"guesserWins"`
+	CluesGiven     int    `firestore:"cluesGiven"`
+	ClueWords      int    `firestore:"clueWords"`
+	Guesses        int    `firestore:"guesses"`
+	CorrectGuesses int    `firestore:"correctGuesses"`
+	AssassinHits   int    `firestore:"assassinHits"`
+	UpdatedAt      int64  `firestore:"updatedAt"`
+}
+
+// AddPlayerStats adds the given totals, multiplied by sign, to the stats of each player.
+// A sign of -1 takes back a round that was counted before.
+func AddPlayerStats(ctx context.Context, client *firestore.Client, stats map[string]PlayerStats, sign int) error {
+	if len(stats) == 0 {
+		return nil
+	}
+	batch := client.Batch()
+	now := time.Now().Unix()
+	for playerID, s := range stats {
+		ref := client.Collection("players").Doc(playerID)
+		batch.Set(ref, map[string]interface{}{
+			"name":           s.Name,
+			"gamesPlayed":    firestore.Increment(sign * s.GamesPlayed),
+			"wins":           firestore.Increment(sign * s.Wins),
+			"spyGames":       firestore.Increment(sign * s.SpyGames),
+			"spyWins":        firestore.Increment(sign * s.SpyWins),
+			"guesserGames":   firestore.Increment(sign * s.GuesserGames),
+			"guesserWins":    firestore.Increment(sign * s.GuesserWins),
+			"cluesGiven":     firestore.Increment(sign * s.CluesGiven),
+			"clueWords":      firestore.Increment(sign * s.ClueWords),
+			"guesses":        firestore.Increment(sign * s.Guesses),
+			"correctGuesses": firestore.Increment(sign * s.CorrectGuesses),
+			"assassinHits":   firestore.Increment(sign * s.AssassinHits),
+			"updatedAt":      now,
+		}, firestore.MergeAll)
+	}
+	_, err := batch.Commit(ctx)
+	if err != nil {
+		log.Printf("AddPlayerStats: An error has occurred: %s", err)
+	}
+	return err
+}
+
+// GetPlayerStats returns the stats of the given players. Players that never finished a game are left out.
+func GetPlayerStats(ctx context.Context, client *firestore.Client, playerIDs []string) (map[string]PlayerStats, error) {
+	refs := make([]*firestore.DocumentRef, 0, len(playerIDs))
+	for _, playerID := range playerIDs {
+		refs = append(refs, client.Collection("players").Doc(playerID))
+	}
+	docs, err := client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]PlayerStats, len(docs))
+	for _, doc := range docs {
+		if !doc.Exists() {
+			continue
+		}
+		var s PlayerStats
+		if err := doc.DataTo(&s); err != nil {
+			return nil, err
+		}
+		stats[doc.Ref.ID] = s
+	}
+	return stats, nil
+}
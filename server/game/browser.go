@@ -0,0 +1,76 @@
+package game
+
+import (
+	"sort"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// Visibility settings decide whether a game is listed in the game browser.
+const (
+	// VisibilityPublic lists the game while it waits for players
+	VisibilityPublic = "public"
+	// VisibilityPrivate keeps the game reachable by its ID only
+	VisibilityPrivate = "private"
+)
+
+// OpenGame what the game browser shows about a public game waiting for players
+type OpenGame struct {
+	ID                string
+	Host              string
+	Players           int
+	PlayerLimit       int
+	PasswordProtected bool
+	GuessPolicy       string
+	RotationPolicy    string
+	UpdatedAt         int64
+}
+
+// MapOpenGame takes a db game and maps it to its game browser entry.
+func MapOpenGame(game *db.Game, playerLimit int) OpenGame {
+	guessPolicy := game.GuessPolicy
+	if guessPolicy == "" {
+		guessPolicy = GuessPolicySingle
+	}
+	rotationPolicy := game.RotationPolicy
+	if rotationPolicy == "" {
+		rotationPolicy = RotationNone
+	}
+	return OpenGame{
+		ID:                game.ID,
+		Host:              game.Players[game.CreatorID],
+		Players:           len(game.Players),
+		PlayerLimit:       playerLimit,
+		PasswordProtected: game.PasswordHash != "",
+		GuessPolicy:       guessPolicy,
+		RotationPolicy:    rotationPolicy,
+		UpdatedAt:         game.UpdatedAt,
+	}
+}
+
+// QuickJoinCandidates returns the open games a player can join without a password, best match first:
+// the games closest to being ready to start, then the most recently active.
+func QuickJoinCandidates(games []*db.Game, playerName string) []*db.Game {
+	candidates := []*db.Game{}
+	for _, game := range games {
+		if game.PasswordHash != "" {
+			continue
+		}
+		nameTaken := false
+		for _, otherPlayerName := range game.Players {
+			if otherPlayerName == playerName {
+				nameTaken = true
+			}
+		}
+		if !nameTaken {
+			candidates = append(candidates, game)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if len(candidates[i].Players) != len(candidates[j].Players) {
+			return len(candidates[i].Players) > len(candidates[j].Players)
+		}
+		return candidates[i].UpdatedAt > candidates[j].UpdatedAt
+	})
+	return candidates
+}
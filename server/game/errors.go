@@ -0,0 +1,17 @@
+package game
+
+import "errors"
+
+// Errors returned when an action can't be taken. Their messages double as the error codes sent to clients.
+var (
+	ErrPlayerAlreadyAdded = errors.New("PlayerAlreadyAdded")
+	ErrNameAlreadyTaken   = errors.New("NameAlreadyTaken")
+	ErrGameIsFull         = errors.New("GameIsFull")
+	ErrGameAlreadyStarted = errors.New("GameAlreadyStarted")
+	ErrPasswordRequired   = errors.New("PasswordRequired")
+	ErrWrongPassword      = errors.New("WrongPassword")
+	ErrPasswordTooLong    = errors.New("PasswordTooLong")
+	ErrNoFinishedRounds   = errors.New("NoFinishedRounds")
+	ErrRoundNotFinished   = errors.New("RoundNotFinished")
+	ErrHistoryIncomplete  = errors.New("HistoryIncomplete")
+)
@@ -0,0 +1,161 @@
+package game
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// ExportCard a word on the board along with the team it belonged to
+type ExportCard struct {
+	Word      string
+	Index     int
+	BelongsTo string
+}
+
+// Export collection of everything needed to review a finished round
+type Export struct {
+	GameID          string
+	Round           int
+	StartedAt       int64
+	FinishedAt      int64
+	Winner          string
+	Cards           []ExportCard
+	TeamRed         []string
+	TeamBlue        []string
+	TeamRedSpy      string
+	TeamBlueSpy     string
+	TeamRedGuesser  string
+	TeamBlueGuesser string
+	Moves           []GameEvent
+}
+
+// round is the slice of a game's history between a start event and the win that ended it.
+type round struct {
+	number int
+	start  int
+	end    int
+}
+
+// finishedRounds returns every round of the game that has been won.
+func finishedRounds(game *db.Game) []round {
+	rounds := []round{}
+	number := 0
+	if game.Checkpoint != nil {
+		number = game.Checkpoint.Rounds
+	}
+	start := -1
+	for i, event := range game.Events {
+		switch event.Type {
+		case db.EventStart:
+			number++
+			start = i
+		case db.EventWin:
+			if start >= 0 {
+				rounds = append(rounds, round{number: number, start: start, end: i})
+				start = -1
+			}
+		case db.EventUndo:
+			// The guess that won the last round was taken back, so that round is still being played.
+			if last := len(rounds) - 1; start < 0 && last >= 0 && game.Events[rounds[last].end].Seq > event.Target {
+				start = rounds[last].start
+				rounds = rounds[:last]
+			}
+		}
+	}
+	return rounds
+}
+
+// findFinishedRound returns the requested round, or the latest finished round when number is 0.
+func findFinishedRound(game *db.Game, number int) (*round, error) {
+	if game == nil {
+		return nil, errors.New("Received a nil game")
+	}
+	rounds := finishedRounds(game)
+	if len(rounds) == 0 {
+		return nil, ErrNoFinishedRounds
+	}
+	if number == 0 {
+		return &rounds[len(rounds)-1], nil
+	}
+	for _, r := range rounds {
+		if r.number == number {
+			return &r, nil
+		}
+	}
+	return nil, ErrRoundNotFinished
+}
+
+// ExportRound builds an Export of a finished round. Passing 0 exports the latest finished round.
+func ExportRound(game *db.Game, number int) (*Export, error) {
+	r, err := findFinishedRound(game, number)
+	if err != nil {
+		return nil, err
+	}
+	// Rebuild the game as it was when the round started so the roles are the ones that were played.
+	atStart, err := rebuild(game, r.start+1)
+	if err != nil {
+		return nil, err
+	}
+	baseGame, err := MapGameToBaseGame(atStart)
+	if err != nil {
+		return nil, err
+	}
+	start := game.Events[r.start]
+	end := game.Events[r.end]
+	export := &Export{
+		GameID:          game.ID,
+		Round:           r.number,
+		StartedAt:       start.At,
+		FinishedAt:      end.At,
+		Winner:          end.Team,
+		Cards:           make([]ExportCard, 0, len(start.Cards)),
+		TeamRed:         baseGame.TeamRed,
+		TeamBlue:        baseGame.TeamBlue,
+		TeamRedSpy:      atStart.TeamRedSpy,
+		TeamBlueSpy:     atStart.TeamBlueSpy,
+		TeamRedGuesser:  atStart.TeamRedGuesser,
+		TeamBlueGuesser: atStart.TeamBlueGuesser,
+		Moves:           []GameEvent{},
+	}
+	for word, card := range start.Cards {
+		export.Cards = append(export.Cards, ExportCard{Word: word, Index: card.Index, BelongsTo: card.BelongsTo})
+	}
+	sort.Slice(export.Cards, func(i, j int) bool { return export.Cards[i].Index < export.Cards[j].Index })
+	for _, event := range game.Events[r.start+1 : r.end+1] {
+		export.Moves = append(export.Moves, mapEvent(event))
+	}
+	return export, nil
+}
+
+// ReplayFrames returns what a spectator saw after each move of a finished round, starting with the fresh board.
+// Passing 0 replays the latest finished round.
+func ReplayFrames(game *db.Game, number int) ([]PlayerGame, error) {
+	r, err := findFinishedRound(game, number)
+	if err != nil {
+		return nil, err
+	}
+	state, err := rebuild(game, r.start)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]PlayerGame, 0, r.end-r.start+1)
+	for _, event := range game.Events[r.start : r.end+1] {
+		state, err = Reduce(state, event)
+		if err != nil {
+			return nil, err
+		}
+		state.Events = append(state.Events, event)
+		if event.Type == db.EventWin {
+			// Some moves (a winning guess) are made of several events, only show the result.
+			frames = frames[:len(frames)-1]
+		}
+		baseGame, err := MapGameToBaseGame(state)
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, PlayerGame{BaseGame: *baseGame})
+	}
+	return frames, nil
+}
@@ -4,14 +4,24 @@ import (
 	"context"
 	"errors"
 	"log"
-	"math/rand"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
 	"github.com/RobertDHanna/OpenCodenames/config"
-	"github.com/RobertDHanna/OpenCodenames/data"
 	"github.com/RobertDHanna/OpenCodenames/db"
-	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// Guess policies decide which members of a team may guess cards.
+const (
+	// GuessPolicySingle only the team's designated guesser may guess
+	GuessPolicySingle = "single"
+	// GuessPolicyAny every member of the team but the spy may guess
+	GuessPolicyAny = "any"
+	// GuessPolicyVote a card is guessed once most of the team's connected operatives picked it
+	GuessPolicyVote = "vote"
 )
 
 // BaseGame collection of fields that every participant needs
@@ -30,15 +40,59 @@ type BaseGame struct {
 	LastCardGuessed          string
 	LastCardGuessedBy        string
 	LastCardGuessedCorrectly bool
+	Events                   []GameEvent // the latest moves of the round, see recentMoves
+	UndoProposal             *UndoProposal
+	GuessPolicy              string
+	RotationPolicy           string
+	SpyCounts                map[string]int
+	TeamsLocked              bool
+	AllowTeamRequests        bool
+	TeamRequests             map[string]string
+	Scoreboard               Scoreboard
+	PasswordProtected        bool
+	SpectatorsNeedPassword   bool
+	Public                   bool
+}
+
+// UndoProposal a pending request to undo the last guess
+type UndoProposal struct {
+	Word        string
+	ProposedBy  string
+	Votes       []string
+	VotesNeeded int
+	ExpiresAt   int64
+}
+
+// GameEvent is an entry of the game's history as shown to participants.
+type GameEvent struct {
+	Seq       int64
+	Type      string
+	At        int64
+	Actor     string
+	Player    string
+	Role      string
+	Team      string
+	Word      string
+	Count     int
+	BelongsTo string
+	Correct   bool
+	Target    int64
+	Setting   string
 }
 
 // PlayerGame collection of fields that only players (not spectators) need
 type PlayerGame struct {
-	You          string
-	YouOwnGame   bool
-	YourTurn     bool
-	GameCanStart bool
-	BaseGame     BaseGame
+	You             string
+	YouOwnGame      bool
+	YourTurn        bool
+	GameCanStart    bool
+	TeamVotes       map[string]string
+	TeamSuggestions map[string]string
+	BaseGame        BaseGame
+}
+
+func validGuessPolicy(policy string) bool {
+	return policy == GuessPolicySingle || policy == GuessPolicyAny || policy == GuessPolicyVote
 }
 
 func playerCanGuess(game *db.Game, playerID string) bool {
@@ -47,36 +101,126 @@ func playerCanGuess(game *db.Game, playerID string) bool {
 	}
 	redPlayerName, playerOnTeamRed := game.TeamRed[playerID]
 	bluePlayerName, playerOnTeamBlue := game.TeamBlue[playerID]
+	if game.GuessPolicy == GuessPolicyAny || game.GuessPolicy == GuessPolicyVote {
+		return (playerOnTeamRed && game.WhoseTurn == "red" && game.TeamRedSpy != redPlayerName) ||
+			(playerOnTeamBlue && game.WhoseTurn == "blue" && game.TeamBlueSpy != bluePlayerName)
+	}
 	return (playerOnTeamRed && game.WhoseTurn == "red" && game.TeamRedGuesser == redPlayerName) ||
 		(playerOnTeamBlue && game.WhoseTurn == "blue" && game.TeamBlueGuesser == bluePlayerName)
 }
 
-func playerGuessedCardCorrectly(game *db.Game, card *db.Card, playerID string) bool {
-	if game == nil || card == nil {
+func playerCanEndTurn(game *db.Game, playerID string) bool {
+	// Whoever is allowed to guess is also allowed to stop guessing.
+	return playerCanGuess(game, playerID)
+}
+
+// teamVotes returns the votes of the player's team keyed by player name.
+func teamVotes(game *db.Game, playerID string) map[string]string {
+	votes := game.TeamBlueVotes
+	if _, playerOnTeamRed := game.TeamRed[playerID]; playerOnTeamRed {
+		votes = game.TeamRedVotes
+	} else if _, playerOnTeamBlue := game.TeamBlue[playerID]; !playerOnTeamBlue {
+		return map[string]string{}
+	}
+	namedVotes := make(map[string]string, len(votes))
+	for voterID, word := range votes {
+		namedVotes[game.Players[voterID]] = word
+	}
+	return namedVotes
+}
+
+// PlayerCanSuggest reports whether a player may point at a card for their teammates. An empty word clears the suggestion.
+func PlayerCanSuggest(game *db.Game, playerID string, word string) bool {
+	if game == nil || game.Status != "running" {
+		return false
+	}
+	redPlayerName, playerOnTeamRed := game.TeamRed[playerID]
+	bluePlayerName, playerOnTeamBlue := game.TeamBlue[playerID]
+	if !(playerOnTeamRed && game.WhoseTurn == "red" && game.TeamRedSpy != redPlayerName) &&
+		!(playerOnTeamBlue && game.WhoseTurn == "blue" && game.TeamBlueSpy != bluePlayerName) {
 		return false
 	}
-	_, playerOnTeamRed := game.TeamRed[playerID]
-	_, playerOnTeamBlue := game.TeamBlue[playerID]
-	return (card.BelongsTo == "red" && playerOnTeamRed) || (card.BelongsTo == "blue" && playerOnTeamBlue)
+	card, cardFound := game.Cards[word]
+	return word == "" || (cardFound && !card.Guessed)
 }
 
-func playerCanEndTurn(game *db.Game, playerID string) bool {
-	if game == nil {
+// TeamSuggestions returns the cards the player's teammates are pointing at keyed by player name.
+func TeamSuggestions(game *db.Game, playerID string, suggestions map[string]string) map[string]string {
+	team := game.TeamBlue
+	if _, playerOnTeamRed := game.TeamRed[playerID]; playerOnTeamRed {
+		team = game.TeamRed
+	}
+	teamSuggestions := map[string]string{}
+	for suggesterID, word := range suggestions {
+		if suggesterName, onTeam := team[suggesterID]; onTeam {
+			teamSuggestions[suggesterName] = word
+		}
+	}
+	return teamSuggestions
+}
+
+// recentMoves returns the latest clues and guesses of the current round that weren't taken back, which is all of
+// the history the board shows. Every participant gets them with every update, so the rest of the log is left to
+// ExportRound.
+func recentMoves(game *db.Game) []GameEvent {
+	start := 0
+	for i := len(game.Events) - 1; i >= 0; i-- {
+		if game.Events[i].Type == db.EventStart {
+			start = i
+			break
+		}
+	}
+	moves := []GameEvent{}
+	for _, event := range db.Applied(game.Events[start:]) {
+		if event.Type == db.EventClue || event.Type == db.EventGuess {
+			moves = append(moves, mapEvent(event))
+		}
+	}
+	if limit := config.RecentMoves(); len(moves) > limit {
+		moves = moves[len(moves)-limit:]
+	}
+	return moves
+}
+
+func playerCanGiveClue(game *db.Game, playerID string) bool {
+	if game == nil || game.Status != "running" {
 		return false
 	}
-	playerNameRed, playerOnTeamRed := game.TeamRed[playerID]
-	playerNameBlue, playerOnTeamBlue := game.TeamBlue[playerID]
-	return (playerOnTeamRed && game.TeamRedGuesser == playerNameRed && game.WhoseTurn == "red") ||
-		(playerOnTeamBlue && game.TeamBlueGuesser == playerNameBlue && game.WhoseTurn == "blue")
+	playerName, playerFound := game.Players[playerID]
+	return playerFound && ((game.WhoseTurn == "red" && game.TeamRedSpy == playerName) ||
+		(game.WhoseTurn == "blue" && game.TeamBlueSpy == playerName))
 }
 
-func playerCanUpdateTeams(game *db.Game, playerID string) bool {
+func playerIsHostInLobby(game *db.Game, playerID string) bool {
 	if game == nil {
 		return false
 	}
 	return game.CreatorID == playerID && game.Status == "pending"
 }
 
+func playerCanUpdateTeams(game *db.Game, playerID string) bool {
+	return playerIsHostInLobby(game, playerID) && !game.TeamsLocked
+}
+
+// mapEvent strips the fields of an event participants shouldn't see, like player IDs and the board's key.
+func mapEvent(event db.Event) GameEvent {
+	return GameEvent{
+		Seq:       event.Seq,
+		Type:      event.Type,
+		At:        event.At,
+		Actor:     event.Actor,
+		Player:    event.Player,
+		Role:      event.Role,
+		Team:      event.Team,
+		Word:      event.Word,
+		Count:     event.Count,
+		BelongsTo: event.BelongsTo,
+		Correct:   event.Correct,
+		Target:    event.Target,
+		Setting:   event.Setting,
+	}
+}
+
 // MapGameToBaseGame takes a db game and maps it to a BaseGame
 func MapGameToBaseGame(game *db.Game) (*BaseGame, error) {
 	if game == nil {
@@ -109,6 +253,44 @@ func MapGameToBaseGame(game *db.Game) (*BaseGame, error) {
 		LastCardGuessed:          game.LastCardGuessed,
 		LastCardGuessedBy:        game.LastCardGuessedBy,
 		LastCardGuessedCorrectly: game.LastCardGuessedCorrectly,
+		Events:                   recentMoves(game),
+		GuessPolicy:              game.GuessPolicy,
+		RotationPolicy:           game.RotationPolicy,
+		SpyCounts:                make(map[string]int, len(game.SpyCounts)),
+		TeamsLocked:              game.TeamsLocked,
+		AllowTeamRequests:        game.AllowTeamRequests,
+		TeamRequests:             make(map[string]string, len(game.TeamRequests)),
+		Scoreboard:               mapScoreboard(game.Scoreboard),
+		PasswordProtected:        game.PasswordHash != "",
+		SpectatorsNeedPassword:   game.SpectatorsNeedPassword,
+		Public:                   game.Public,
+	}
+	for playerID, role := range game.TeamRequests {
+		if playerName, playerFound := game.Players[playerID]; playerFound {
+			baseGame.TeamRequests[playerName] = role
+		}
+	}
+	for playerID, count := range game.SpyCounts {
+		if playerName, playerFound := game.Players[playerID]; playerFound {
+			baseGame.SpyCounts[playerName] = count
+		}
+	}
+	if proposal := game.UndoProposal; proposal != nil {
+		baseGame.UndoProposal = &UndoProposal{
+			Word:        proposal.Word,
+			ProposedBy:  proposal.ProposedBy,
+			Votes:       make([]string, 0, len(proposal.Votes)),
+			VotesNeeded: len(game.Players)/2 + 1,
+		}
+		for _, event := range game.Events {
+			if event.Seq == proposal.Target {
+				baseGame.UndoProposal.ExpiresAt = event.At + int64(config.UndoWindow()/time.Millisecond)
+			}
+		}
+		for _, playerName := range proposal.Votes {
+			baseGame.UndoProposal.Votes = append(baseGame.UndoProposal.Votes, playerName)
+		}
+		sort.Strings(baseGame.UndoProposal.Votes)
 	}
 	for _, playerName := range game.Players {
 		baseGame.Players = append(baseGame.Players, playerName)
@@ -119,6 +301,10 @@ func MapGameToBaseGame(game *db.Game) (*BaseGame, error) {
 	for _, playerName := range game.TeamBlue {
 		baseGame.TeamBlue = append(baseGame.TeamBlue, playerName)
 	}
+	// Sorted so an unchanged game maps to the same view and delta updates stay small.
+	sort.Strings(baseGame.Players)
+	sort.Strings(baseGame.TeamRed)
+	sort.Strings(baseGame.TeamBlue)
 	return baseGame, nil
 }
 
@@ -133,6 +319,7 @@ func MapGameToGuesserGame(game *db.Game, playerID string) (*PlayerGame, error) {
 		YouOwnGame:   game.CreatorID == playerID,
 		YourTurn:     false,
 		GameCanStart: len(game.Players) >= 4 && len(game.Players) <= config.PlayerLimit(),
+		TeamVotes:    teamVotes(game, playerID),
 		BaseGame:     *baseGame,
 	}
 	if _, ok := game.TeamRed[playerID]; ok && game.WhoseTurn == "red" {
@@ -158,6 +345,7 @@ func MapGameToSpyGame(game *db.Game, playerID string) (*PlayerGame, error) {
 		YouOwnGame:   game.CreatorID == playerID,
 		YourTurn:     false,
 		GameCanStart: len(game.Players) >= 4 && len(game.Players) <= config.PlayerLimit(),
+		TeamVotes:    teamVotes(game, playerID),
 		BaseGame:     *baseGame,
 	}
 	if _, ok := game.TeamRed[playerID]; ok && game.WhoseTurn == "red" {
@@ -168,170 +356,90 @@ func MapGameToSpyGame(game *db.Game, playerID string) (*PlayerGame, error) {
 	return spyGame, nil
 }
 
+// MapGameForPlayer maps a db game to what the given player may see, the spy's view for spies and the
+// guesser's view for everyone else.
+func MapGameForPlayer(game *db.Game, playerID string) (*PlayerGame, error) {
+	if game == nil {
+		return nil, errors.New("Received a nil game")
+	}
+	playerName, playerFound := game.Players[playerID]
+	if playerFound && (game.TeamRedSpy == playerName || game.TeamBlueSpy == playerName) {
+		return MapGameToSpyGame(game, playerID)
+	}
+	return MapGameToGuesserGame(game, playerID)
+}
+
+// commit runs decide against the stored game and persists the resulting events.
+func commit(ctx context.Context, client *firestore.Client, gameID string, decide db.Decider) error {
+	err := db.CommitEvents(ctx, client, gameID, decide, Reduce)
+	if err != nil {
+		log.Println("Could not commit game events", gameID, err)
+	}
+	return err
+}
+
+// AddPlayerToGame Adds a player to a game if it still pending. It also attempts to set a role for the given player.
+func AddPlayerToGame(ctx context.Context, client *firestore.Client, gameID string, playerID string, playerName string) error {
+	return db.CommitEvents(ctx, client, gameID, func(game *db.Game) ([]db.Event, error) {
+		return decideJoin(game, playerID, playerName)
+	}, Reduce)
+}
+
 // HandleGameStart takes in a game and puts it into a "running" state
 func HandleGameStart(ctx context.Context, client *firestore.Client, game *db.Game, playerID string) {
-	if game.Status == "pending" && len(game.Players) >= 4 && game.CreatorID == playerID {
-		log.Println("Starting Game", game.ID)
-		if game.TeamBlueSpy == "" || game.TeamBlueGuesser == "" || game.TeamRedSpy == "" || game.TeamRedGuesser == "" {
-			log.Println("Game cannot start, required roles are not filled")
-			return
-		}
-		wordList := data.GetWordList()
-		chosenWords := make([]string, 0, 25)
-		for {
-			randomWord := wordList[rand.Intn(len(wordList))]
-			if _, contains := utils.Contains(chosenWords, randomWord); contains {
-				continue
-			}
-			chosenWords = append(chosenWords, randomWord)
-			if len(chosenWords) == 25 {
-				break
-			}
-		}
-		cards := map[string]db.Card{}
-		i := 0
-		for _, word := range chosenWords {
-			cards[word] = db.Card{BelongsTo: "", Guessed: false, Index: i}
-			i++
-		}
-		teamRedWords := make([]string, 0, 9)
-		teamBlueWords := make([]string, 0, 8)
-		// Select the bomb card
-		blackWord := chosenWords[rand.Intn(len(chosenWords))]
-		if card, ok := cards[blackWord]; ok {
-			cards[blackWord] = db.Card{BelongsTo: "black", Guessed: false, Index: card.Index}
-		}
-		// Select red cards
-		for j := 0; j < 8; j++ {
-			randomWord := ""
-			for {
-				randomWord = chosenWords[rand.Intn(len(chosenWords))]
-				if randomWord == blackWord {
-					continue
-				}
-				if _, contains := utils.Contains(teamRedWords, randomWord); contains {
-					continue
-				}
-				teamRedWords = append(teamRedWords, randomWord)
-				break
-			}
-			if card, ok := cards[randomWord]; ok {
-				cards[randomWord] = db.Card{BelongsTo: "red", Guessed: false, Index: card.Index}
-			} else {
-				log.Println("red not found", randomWord)
-			}
-		}
-		// Select blue cards
-		for j := 0; j < 9; j++ {
-			randomWord := ""
-			for {
-				randomWord = chosenWords[rand.Intn(len(chosenWords))]
-				if randomWord == blackWord {
-					continue
-				}
-				if _, contains := utils.Contains(teamBlueWords, randomWord); contains {
-					continue
-				}
-				if _, contains := utils.Contains(teamRedWords, randomWord); contains {
-					continue
-				}
-				teamBlueWords = append(teamBlueWords, randomWord)
-				break
-			}
-			if card, ok := cards[randomWord]; ok {
-				cards[randomWord] = db.Card{BelongsTo: "blue", Guessed: false, Index: card.Index}
-			} else {
-				log.Println("blue not found", randomWord)
-			}
-		}
-		db.UpdateGame(ctx, client, game.ID, map[string]interface{}{
-			"status":    "running",
-			"cards":     cards,
-			"whoseTurn": "blue",
-		})
+	if game == nil {
+		return
 	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideStart(game, playerID), nil
+	})
 }
 
-// HandlePlayerGuess takes in an action, determines if they player is allowed to make a guess, and processes the guess
-func HandlePlayerGuess(ctx context.Context, client *firestore.Client, action string, playerID string, game *db.Game) {
+// HandlePlayerGuess takes in an action, determines if they player is allowed to make a guess, and processes the guess.
+// connected holds the IDs of the players that are currently connected to the game.
+func HandlePlayerGuess(ctx context.Context, client *firestore.Client, action string, playerID string, game *db.Game, connected map[string]bool) {
 	actionParts := strings.SplitN(action, " ", 2)
 	if len(actionParts) != 2 {
 		log.Println("Received an incorrectly formatted guess", actionParts, playerID)
 		return
 	}
-	word := actionParts[1]
-	if playerCanGuess(game, playerID) {
-		card, cardFound := game.Cards[word]
-		if cardFound && !card.Guessed {
-			newCards := map[string]db.Card{}
-			for key, card := range game.Cards {
-				newCards[key] = card
-			}
-			newCards[word] = db.Card{
-				Index:     card.Index,
-				BelongsTo: card.BelongsTo,
-				Guessed:   true}
-			status := game.Status
-			whoseTurn := game.WhoseTurn
-			if card.BelongsTo == "black" {
-				whoseTurn = "over"
-				if game.WhoseTurn == "red" {
-					status = "bluewon"
-				} else {
-					status = "redwon"
-				}
-			} else if !playerGuessedCardCorrectly(game, &card, playerID) {
-				if game.WhoseTurn == "red" {
-					whoseTurn = "blue"
-				} else {
-					whoseTurn = "red"
-				}
-			}
-			redCardsGuessed := 0
-			blueCardsGuessed := 0
-			for _, card := range newCards {
-				if !card.Guessed {
-					continue
-				}
-				if card.BelongsTo == "blue" {
-					blueCardsGuessed++
-				} else if card.BelongsTo == "red" {
-					redCardsGuessed++
-				}
-			}
-			if blueCardsGuessed == 9 {
-				whoseTurn = "over"
-				status = "bluewon"
-			}
-			if redCardsGuessed == 8 {
-				whoseTurn = "over"
-				status = "redwon"
-			}
-			db.UpdateGame(ctx, client, game.ID, map[string]interface{}{
-				"cards":                    newCards,
-				"status":                   status,
-				"whoseTurn":                whoseTurn,
-				"lastCardGuessed":          word,
-				"lastCardGuessedBy":        game.Players[playerID],
-				"lastCardGuessedCorrectly": card.BelongsTo == game.WhoseTurn,
-			})
-		}
+	if game == nil {
+		return
 	}
+	word := actionParts[1]
+	commitAndRecordStats(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideGuess(game, playerID, word, connected)
+	})
 }
 
 // HandleEndTurn Ends the turn for the given team.
 func HandleEndTurn(ctx context.Context, client *firestore.Client, game *db.Game, playerID string) {
-	if playerCanEndTurn(game, playerID) {
-		whoseTurn := game.WhoseTurn
-		if game.WhoseTurn == "red" {
-			whoseTurn = "blue"
-		} else {
-			whoseTurn = "red"
-		}
-		db.UpdateGame(ctx, client, game.ID, map[string]interface{}{
-			"whoseTurn": whoseTurn,
-		})
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideEndTurn(game, playerID), nil
+	})
+}
+
+// HandleGiveClue records the clue the spy of the active team gave to their guesser.
+func HandleGiveClue(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 3 {
+		log.Println("Received an incorrectly formatted clue", actionParts, playerID)
+		return
+	}
+	count, err := strconv.Atoi(actionParts[2])
+	if err != nil || count < 0 {
+		log.Println("Received a clue with an invalid count", actionParts, playerID)
+		return
 	}
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideClue(game, playerID, actionParts[1], count), nil
+	})
 }
 
 // HandleRestartGame restarts the active game if it is finished.
@@ -339,17 +447,9 @@ func HandleRestartGame(ctx context.Context, client *firestore.Client, game *db.G
 	if game == nil {
 		return
 	}
-	if game.WhoseTurn == "over" {
-		db.UpdateGame(ctx, client, game.ID, map[string]interface{}{
-			"cards":                    map[string]interface{}{},
-			"status":                   "pending",
-			"whoseTurn":                "blue",
-			"lastCardGuessed":          "",
-			"lastCardGuessedBy":        "",
-			"lastCardGuessedCorrectly": false,
-			"timesPlayed":              game.TimesPlayed + 1,
-		})
-	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideRestart(game, playerID), nil
+	})
 }
 
 // HandleUpdateTeams moves a player to a new team/role.
@@ -359,82 +459,160 @@ func HandleUpdateTeams(ctx context.Context, client *firestore.Client, game *db.G
 		log.Println("Received an incorrectly formatted update teams request", actionParts, playerID)
 		return
 	}
-	if playerCanUpdateTeams(game, playerID) {
-		requestedPlayerName := actionParts[1]
-		newRole := actionParts[2]
-		fieldsToUpdate := map[string]interface{}{}
-		playerIsOnTeamRed := false
-		playerIsOnTeamBlue := false
-		requestedPlayerID := ""
-		for playerID, playerName := range game.TeamRed {
-			if playerName == requestedPlayerName {
-				playerIsOnTeamRed = true
-				requestedPlayerID = playerID
-				break
-			}
-		}
-		for playerID, playerName := range game.TeamBlue {
-			if playerName == requestedPlayerName {
-				playerIsOnTeamBlue = true
-				requestedPlayerID = playerID
-				break
-			}
-		}
-		if !playerIsOnTeamRed && !playerIsOnTeamBlue {
-			log.Println("Update teams received a player that doesn't belong to game: ", game.ID)
-			return
-		}
-		checkAndClearRolesIfNecessary := func() {
-			if game.TeamRedSpy == requestedPlayerName {
-				fieldsToUpdate["teamRedSpy"] = ""
-			} else if game.TeamRedGuesser == requestedPlayerName {
-				fieldsToUpdate["teamRedGuesser"] = ""
-			} else if game.TeamBlueSpy == requestedPlayerName {
-				fieldsToUpdate["teamBlueSpy"] = ""
-			} else if game.TeamBlueGuesser == requestedPlayerName {
-				fieldsToUpdate["teamBlueGuesser"] = ""
-			}
-		}
-		handleBlueToRedTeamSwitch := func() {
-			if playerIsOnTeamBlue {
-				delete(game.TeamBlue, requestedPlayerID)
-				game.TeamRed[requestedPlayerID] = requestedPlayerName
-				fieldsToUpdate["teamBlue"] = game.TeamBlue
-				fieldsToUpdate["teamRed"] = game.TeamRed
-			}
-		}
-		handleRedToBlueTeamSwitch := func() {
-			if playerIsOnTeamRed {
-				delete(game.TeamRed, requestedPlayerID)
-				game.TeamBlue[requestedPlayerID] = requestedPlayerName
-				fieldsToUpdate["teamBlue"] = game.TeamBlue
-				fieldsToUpdate["teamRed"] = game.TeamRed
-			}
-		}
-		switch newRole {
-		case "bluespy":
-			checkAndClearRolesIfNecessary()
-			fieldsToUpdate["teamBlueSpy"] = requestedPlayerName
-			handleRedToBlueTeamSwitch()
-		case "blueguesser":
-			checkAndClearRolesIfNecessary()
-			fieldsToUpdate["teamBlueGuesser"] = requestedPlayerName
-			handleRedToBlueTeamSwitch()
-		case "redspy":
-			checkAndClearRolesIfNecessary()
-			fieldsToUpdate["teamRedSpy"] = requestedPlayerName
-			handleBlueToRedTeamSwitch()
-		case "redguesser":
-			checkAndClearRolesIfNecessary()
-			fieldsToUpdate["teamRedGuesser"] = requestedPlayerName
-			handleBlueToRedTeamSwitch()
-		case "blueobs":
-			checkAndClearRolesIfNecessary()
-			handleRedToBlueTeamSwitch()
-		case "redobs":
-			checkAndClearRolesIfNecessary()
-			handleBlueToRedTeamSwitch()
-		}
-		db.UpdateGame(ctx, client, game.ID, fieldsToUpdate)
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideTeamChange(game, playerID, actionParts[1], actionParts[2]), nil
+	})
+}
+
+// HandleProposeUndo asks the other players to take back the last guess. The host's proposal is approved right away.
+func HandleProposeUndo(ctx context.Context, client *firestore.Client, game *db.Game, playerID string) {
+	if game == nil {
+		return
+	}
+	commitAndRecordStats(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideProposeUndo(game, playerID, time.Now()), nil
+	})
+}
+
+// HandleApproveUndo votes for the pending undo.
+func HandleApproveUndo(ctx context.Context, client *firestore.Client, game *db.Game, playerID string) {
+	if game == nil {
+		return
+	}
+	commitAndRecordStats(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideVoteUndo(game, playerID, time.Now()), nil
+	})
+}
+
+// HandleRejectUndo lets the host cancel the pending undo.
+func HandleRejectUndo(ctx context.Context, client *firestore.Client, game *db.Game, playerID string) {
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideRejectUndo(game, playerID), nil
+	})
+}
+
+// HandleSetGuessPolicy changes which members of a team may guess cards.
+func HandleSetGuessPolicy(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 2 || !validGuessPolicy(actionParts[1]) {
+		log.Println("Received an incorrectly formatted guess policy", actionParts, playerID)
+		return
+	}
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideGuessPolicy(game, playerID, actionParts[1]), nil
+	})
+}
+
+// HandleSetRotationPolicy changes how spies and teams change when the game is restarted.
+func HandleSetRotationPolicy(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 2 || !validRotationPolicy(actionParts[1]) {
+		log.Println("Received an incorrectly formatted rotation policy", actionParts, playerID)
+		return
+	}
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideRotationPolicy(game, playerID, actionParts[1]), nil
+	})
+}
+
+// HandleShuffleTeams lets the host randomize the teams ("RandomizeTeams") or even out their sizes ("BalanceTeams").
+func HandleShuffleTeams(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideShuffleTeams(game, playerID, action == "BalanceTeams"), nil
+	})
+}
+
+// HandleLockTeams lets the host freeze ("LockTeams") or unfreeze ("UnlockTeams") the teams.
+func HandleLockTeams(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideLockTeams(game, playerID, action == "LockTeams"), nil
+	})
+}
+
+// HandleAllowTeamRequests lets the host decide whether players may ask to change their team or role.
+func HandleAllowTeamRequests(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 2 || (actionParts[1] != "on" && actionParts[1] != "off") {
+		log.Println("Received an incorrectly formatted allow team requests action", actionParts, playerID)
+		return
+	}
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideAllowTeamRequests(game, playerID, actionParts[1] == "on"), nil
+	})
+}
+
+// HandleRequestTeam asks the host to move the player to a new team/role.
+func HandleRequestTeam(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 2 || !validRole(actionParts[1]) {
+		log.Println("Received an incorrectly formatted team request", actionParts, playerID)
+		return
+	}
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideRequestTeam(game, playerID, actionParts[1]), nil
+	})
+}
+
+// HandleAnswerTeamRequest lets the host approve ("ApproveTeam <player>") or deny ("DenyTeam <player>") a team request.
+func HandleAnswerTeamRequest(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 2 {
+		log.Println("Received an incorrectly formatted team request answer", actionParts, playerID)
+		return
+	}
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideAnswerTeamRequest(game, playerID, actionParts[1], actionParts[0] == "ApproveTeam"), nil
+	})
+}
+
+// HandleResetScoreboard clears the scoreboard kept across the rounds of the game.
+func HandleResetScoreboard(ctx context.Context, client *firestore.Client, game *db.Game, playerID string) {
+	if game == nil {
+		return
+	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideResetScoreboard(game, playerID), nil
+	})
+}
+
+// HandleSetVisibility lets the host list the game in the game browser ("SetVisibility public") or hide it.
+func HandleSetVisibility(ctx context.Context, client *firestore.Client, game *db.Game, action string, playerID string) {
+	actionParts := strings.Split(action, " ")
+	if len(actionParts) != 2 || (actionParts[1] != VisibilityPublic && actionParts[1] != VisibilityPrivate) {
+		log.Println("Received an incorrectly formatted visibility action", actionParts, playerID)
+		return
+	}
+	if game == nil {
+		return
 	}
+	commit(ctx, client, game.ID, func(game *db.Game) ([]db.Event, error) {
+		return decideVisibility(game, playerID, actionParts[1] == VisibilityPublic), nil
+	})
 }
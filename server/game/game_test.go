@@ -0,0 +1,69 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+func TestMapGameToBaseGameSortsPlayers(t *testing.T) {
+	game := &db.Game{
+		Players:  map[string]string{"p1": "zoe", "p2": "adam", "p3": "mia", "p4": "bob"},
+		TeamRed:  map[string]string{"p1": "zoe", "p3": "mia"},
+		TeamBlue: map[string]string{"p2": "adam", "p4": "bob"},
+	}
+	for i := 0; i < 10; i++ {
+		baseGame, err := MapGameToBaseGame(game)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"adam", "bob", "mia", "zoe"}; !reflect.DeepEqual(baseGame.Players, want) {
+			t.Fatalf("Players = %v, want %v", baseGame.Players, want)
+		}
+		if want := []string{"mia", "zoe"}; !reflect.DeepEqual(baseGame.TeamRed, want) {
+			t.Fatalf("TeamRed = %v, want %v", baseGame.TeamRed, want)
+		}
+		if want := []string{"adam", "bob"}; !reflect.DeepEqual(baseGame.TeamBlue, want) {
+			t.Fatalf("TeamBlue = %v, want %v", baseGame.TeamBlue, want)
+		}
+	}
+}
+
+func TestRecentMoves(t *testing.T) {
+	clue := db.Event{Type: db.EventClue, ActorID: "p1", Actor: "ann", Word: "sea", Count: 2}
+	vote := db.Event{Type: db.EventGuessVote, ActorID: "p2", Actor: "bob", Team: "blue", Word: "ocean"}
+	firstRound := append(append([]db.Event{}, lobby...), start, clue, guess("p2", "bob", "blue", "ocean"), db.Event{Type: db.EventWin, Team: "blue"}, db.Event{Type: db.EventRestart})
+	tests := []struct {
+		name   string
+		events []db.Event
+		want   []string // type and word of each move
+	}{
+		{"lobby", lobby, nil},
+		{"moves of the round", append(append([]db.Event{}, lobby...), start, clue, vote, guess("p2", "bob", "blue", "ocean"), db.Event{Type: db.EventEndTurn}), []string{"clue sea", "guess ocean"}},
+		{"earlier rounds", append(append([]db.Event{}, firstRound...), start, guess("p2", "bob", "blue", "tree")), []string{"guess tree"}},
+		{"undone guess", append(append([]db.Event{}, lobby...), start, clue, guess("p2", "bob", "blue", "tree"), db.Event{Type: db.EventUndo, Target: 7}), []string{"clue sea"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, move := range recentMoves(play(t, test.events...)) {
+				got = append(got, move.Type+" "+move.Word)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("moves %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	events := append(append([]db.Event{}, lobby...), start)
+	for i := 0; i < config.RecentMoves(); i++ {
+		events = append(events, clue)
+	}
+	events = append(events, guess("p2", "bob", "blue", "ocean"))
+	moves := recentMoves(play(t, events...))
+	if len(moves) != config.RecentMoves() || moves[len(moves)-1].Type != db.EventGuess {
+		t.Errorf("%d moves ending with a %s, want the latest %d", len(moves), moves[len(moves)-1].Type, config.RecentMoves())
+	}
+}
@@ -0,0 +1,227 @@
+package game
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// Rotation policies decide how teams and spies change when a game is restarted.
+const (
+	// RotationNone keeps everyone on the same team and in the same role
+	RotationNone = "none"
+	// RotationRotate hands the spy role to the next member of each team
+	RotationRotate = "rotate"
+	// RotationSwap moves every player to the other team, keeping their roles
+	RotationSwap = "swap"
+	// RotationRandom reshuffles all players into new teams and roles
+	RotationRandom = "random"
+	// RotationBalanced reshuffles the teams and makes the players that were spy the least often spies
+	RotationBalanced = "balanced"
+)
+
+func validRotationPolicy(policy string) bool {
+	switch policy {
+	case RotationNone, RotationRotate, RotationSwap, RotationRandom, RotationBalanced:
+		return true
+	}
+	return false
+}
+
+// currentLineup returns the teams and roles of the game as they are.
+func currentLineup(game *db.Game) *db.Lineup {
+	return &db.Lineup{
+		TeamRed:         copyNames(game.TeamRed),
+		TeamBlue:        copyNames(game.TeamBlue),
+		TeamRedSpy:      game.TeamRedSpy,
+		TeamBlueSpy:     game.TeamBlueSpy,
+		TeamRedGuesser:  game.TeamRedGuesser,
+		TeamBlueGuesser: game.TeamBlueGuesser,
+	}
+}
+
+// nextLineup returns the teams and roles for the next round according to the game's rotation policy,
+// or nil if they shouldn't change.
+func nextLineup(game *db.Game) *db.Lineup {
+	switch game.RotationPolicy {
+	case RotationRotate:
+		lineup := currentLineup(game)
+		lineup.TeamRedSpy, lineup.TeamRedGuesser = rotateRoles(game.TeamRed, game.TeamRedSpy)
+		lineup.TeamBlueSpy, lineup.TeamBlueGuesser = rotateRoles(game.TeamBlue, game.TeamBlueSpy)
+		return lineup
+	case RotationSwap:
+		return &db.Lineup{
+			TeamRed:         copyNames(game.TeamBlue),
+			TeamBlue:        copyNames(game.TeamRed),
+			TeamRedSpy:      game.TeamBlueSpy,
+			TeamBlueSpy:     game.TeamRedSpy,
+			TeamRedGuesser:  game.TeamBlueGuesser,
+			TeamBlueGuesser: game.TeamRedGuesser,
+		}
+	case RotationRandom:
+		return shuffledLineup(game, false)
+	case RotationBalanced:
+		return shuffledLineup(game, true)
+	}
+	return nil
+}
+
+// rotateRoles makes the member after the current spy (in name order) the new spy and the old spy their guesser.
+func rotateRoles(team map[string]string, spy string) (string, string) {
+	names := make([]string, 0, len(team))
+	for _, playerName := range team {
+		names = append(names, playerName)
+	}
+	if len(names) == 0 {
+		return "", ""
+	}
+	sort.Strings(names)
+	spyIndex, _ := indexOf(names, spy)
+	newSpy := names[(spyIndex+1)%len(names)]
+	if len(names) == 1 {
+		return newSpy, ""
+	}
+	if spy == "" || spy == newSpy {
+		return newSpy, names[(spyIndex+2)%len(names)]
+	}
+	return newSpy, spy
+}
+
+func indexOf(names []string, target string) (int, bool) {
+	for index, name := range names {
+		if name == target {
+			return index, true
+		}
+	}
+	return -1, false
+}
+
+// shuffledLineup splits the players into two random teams. When balanced is set, the member of each team
+// who has been spy the fewest times becomes the spy.
+func shuffledLineup(game *db.Game, balanced bool) *db.Lineup {
+	playerIDs := make([]string, 0, len(game.Players))
+	for playerID := range game.Players {
+		playerIDs = append(playerIDs, playerID)
+	}
+	sort.Strings(playerIDs)
+	rand.Shuffle(len(playerIDs), func(i, j int) {
+		playerIDs[i], playerIDs[j] = playerIDs[j], playerIDs[i]
+	})
+	// Blue always starts with more cards to find, so it gets the extra player as well.
+	blueIDs := playerIDs[:(len(playerIDs)+1)/2]
+	redIDs := playerIDs[(len(playerIDs)+1)/2:]
+	lineup := &db.Lineup{TeamRed: map[string]string{}, TeamBlue: map[string]string{}}
+	lineup.TeamBlueSpy, lineup.TeamBlueGuesser = pickRoles(game, blueIDs, lineup.TeamBlue, balanced)
+	lineup.TeamRedSpy, lineup.TeamRedGuesser = pickRoles(game, redIDs, lineup.TeamRed, balanced)
+	return lineup
+}
+
+// pickRoles fills team with the given players and returns the names of its spy and guesser.
+func pickRoles(game *db.Game, playerIDs []string, team map[string]string, balanced bool) (string, string) {
+	for _, playerID := range playerIDs {
+		team[playerID] = game.Players[playerID]
+	}
+	if len(playerIDs) == 0 {
+		return "", ""
+	}
+	spyIndex := 0
+	if balanced {
+		for index, playerID := range playerIDs {
+			if game.SpyCounts[playerID] < game.SpyCounts[playerIDs[spyIndex]] {
+				spyIndex = index
+			}
+		}
+	}
+	spy := game.Players[playerIDs[spyIndex]]
+	if len(playerIDs) == 1 {
+		return spy, ""
+	}
+	return spy, game.Players[playerIDs[(spyIndex+1)%len(playerIDs)]]
+}
+
+// applyLineup puts every player on the team and in the role the lineup gives them.
+func applyLineup(game *db.Game, lineup *db.Lineup) {
+	game.TeamRed = copyNames(lineup.TeamRed)
+	game.TeamBlue = copyNames(lineup.TeamBlue)
+	game.TeamRedSpy = lineup.TeamRedSpy
+	game.TeamBlueSpy = lineup.TeamBlueSpy
+	game.TeamRedGuesser = lineup.TeamRedGuesser
+	game.TeamBlueGuesser = lineup.TeamBlueGuesser
+}
+
+// balancedLineup moves players from the bigger team to the smaller one until they differ by at most one
+// player. Players without a role are moved first and roles left empty are handed to players without one.
+func balancedLineup(game *db.Game) *db.Lineup {
+	lineup := currentLineup(game)
+	for {
+		big, small := lineup.TeamBlue, lineup.TeamRed
+		if len(lineup.TeamRed) > len(lineup.TeamBlue) {
+			big, small = lineup.TeamRed, lineup.TeamBlue
+		}
+		if len(big)-len(small) <= 1 {
+			break
+		}
+		playerID := leastImportantMember(lineup, big)
+		playerName := big[playerID]
+		delete(big, playerID)
+		small[playerID] = playerName
+		for _, role := range lineupRoles(lineup) {
+			if *role == playerName {
+				*role = ""
+			}
+		}
+	}
+	fillRole(lineup.TeamRed, &lineup.TeamRedSpy, lineup)
+	fillRole(lineup.TeamRed, &lineup.TeamRedGuesser, lineup)
+	fillRole(lineup.TeamBlue, &lineup.TeamBlueSpy, lineup)
+	fillRole(lineup.TeamBlue, &lineup.TeamBlueGuesser, lineup)
+	return lineup
+}
+
+func lineupRoles(lineup *db.Lineup) []*string {
+	return []*string{&lineup.TeamRedSpy, &lineup.TeamRedGuesser, &lineup.TeamBlueSpy, &lineup.TeamBlueGuesser}
+}
+
+func hasRole(lineup *db.Lineup, playerName string) bool {
+	for _, role := range lineupRoles(lineup) {
+		if *role == playerName {
+			return true
+		}
+	}
+	return false
+}
+
+// leastImportantMember picks the team member whose move disrupts the team the least: players without a
+// role first, then the guesser, then the spy. Names break ties so the result doesn't depend on map order.
+func leastImportantMember(lineup *db.Lineup, team map[string]string) string {
+	rank := func(playerName string) int {
+		switch playerName {
+		case lineup.TeamRedSpy, lineup.TeamBlueSpy:
+			return 2
+		case lineup.TeamRedGuesser, lineup.TeamBlueGuesser:
+			return 1
+		}
+		return 0
+	}
+	chosenID := ""
+	for playerID, playerName := range team {
+		if chosenID == "" || rank(playerName) < rank(team[chosenID]) ||
+			(rank(playerName) == rank(team[chosenID]) && playerName < team[chosenID]) {
+			chosenID = playerID
+		}
+	}
+	return chosenID
+}
+
+// fillRole gives an empty role to the team member without a role that comes first by name.
+func fillRole(team map[string]string, role *string, lineup *db.Lineup) {
+	if *role != "" {
+		return
+	}
+	for _, playerName := range team {
+		if !hasRole(lineup, playerName) && (*role == "" || playerName < *role) {
+			*role = playerName
+		}
+	}
+}
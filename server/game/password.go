@@ -0,0 +1,47 @@
+package game
+
+import (
+	"github.com/RobertDHanna/OpenCodenames/db"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Who a room password is required from.
+const (
+	// PasswordPlayers only asks players joining the game for the password
+	PasswordPlayers = "players"
+	// PasswordEveryone asks spectators for the password as well
+	PasswordEveryone = "everyone"
+)
+
+// bcrypt ignores anything past 72 bytes, so longer passwords are refused rather than silently cut.
+const maxPasswordLength = 72
+
+// RoomPasswordEvent returns the event protecting a new game with a password.
+func RoomPasswordEvent(password string, spectators bool) (db.Event, error) {
+	if len(password) > maxPasswordLength {
+		return db.Event{}, ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return db.Event{}, err
+	}
+	setting := PasswordPlayers
+	if spectators {
+		setting = PasswordEveryone
+	}
+	return db.Event{Type: db.EventPassword, Setting: setting, PasswordHash: string(hash)}, nil
+}
+
+// CheckRoomPassword returns an error when the game asks for a password that wasn't given.
+func CheckRoomPassword(game *db.Game, password string, spectator bool) error {
+	if game.PasswordHash == "" || (spectator && !game.SpectatorsNeedPassword) {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	if bcrypt.CompareHashAndPassword([]byte(game.PasswordHash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// New returns the state of a game before any events have happened.
+func New(gameID string) *db.Game {
+	return &db.Game{
+		ID:        gameID,
+		Status:    "pending",
+		Players:   map[string]string{},
+		TeamRed:   map[string]string{},
+		TeamBlue:  map[string]string{},
+		WhoseTurn: "",
+		Cards:     map[string]db.Card{},
+		Events:    []db.Event{},
+
+		TeamRedVotes:  map[string]string{},
+		TeamBlueVotes: map[string]string{},
+		SpyCounts:     map[string]int{},
+		TeamRequests:  map[string]string{},
+		Scoreboard:    newScoreboard(),
+	}
+}
+
+// Create builds a new game from its first events. Its checkpoint is the empty game, so its whole history can be
+// replayed.
+func Create(gameID string, events []db.Event) (*db.Game, error) {
+	game, err := Replay(New(gameID), events)
+	if err != nil {
+		return nil, err
+	}
+	game.Checkpoint = New(gameID)
+	return game, nil
+}
+
+// Replay rebuilds a game by folding events, in order, into base. Undos and the events they took back are skipped,
+// see db.Applied, so replaying never needs the history before base.
+func Replay(base *db.Game, events []db.Event) (*db.Game, error) {
+	game := clone(base)
+	for _, event := range db.Applied(events) {
+		next, err := Reduce(game, event)
+		if err != nil {
+			return nil, err
+		}
+		game = next
+	}
+	game.Events = append(game.Events, events...)
+	return game, nil
+}
+
+// rebuild returns the game as it was right before game.Events[end] happened, replaying its history from its
+// checkpoint. Games older than the event log can't be rebuilt.
+func rebuild(game *db.Game, end int) (*db.Game, error) {
+	if game.Checkpoint == nil {
+		return nil, ErrHistoryIncomplete
+	}
+	before, err := Replay(game.Checkpoint, game.Events[:end])
+	if err != nil {
+		return nil, err
+	}
+	before.Checkpoint = game.Checkpoint
+	return before, nil
+}
+
+// Reduce returns the game that results from applying event to game. The given game is never modified
+// and the event log is left for the caller to maintain.
+func Reduce(game *db.Game, event db.Event) (*db.Game, error) {
+	if game == nil {
+		return nil, errors.New("Received a nil game")
+	}
+	next := clone(game)
+	switch event.Type {
+	case db.EventStart, db.EventClue, db.EventGuess, db.EventEndTurn, db.EventRestart:
+		// Any new move means the last guess can no longer be undone.
+		next.UndoProposal = nil
+	}
+	switch event.Type {
+	case db.EventStart, db.EventGuess, db.EventEndTurn, db.EventRestart, db.EventGuessPolicy:
+		// Votes are only about the card the team is about to guess.
+		next.TeamRedVotes = map[string]string{}
+		next.TeamBlueVotes = map[string]string{}
+	}
+	switch event.Type {
+	case db.EventJoin:
+		if oldName, playerFound := next.Players[event.ActorID]; playerFound {
+			renamePlayer(next, event.ActorID, oldName, event.Actor)
+			return next, nil
+		}
+		if len(next.Players) == 0 {
+			next.CreatorID = event.ActorID
+		}
+		next.Players[event.ActorID] = event.Actor
+		if err := assignRole(next, event.ActorID, event.Role); err != nil {
+			return nil, err
+		}
+	case db.EventTeamChange:
+		playerID, playerFound := findTeamMember(next, event.Player)
+		if !playerFound {
+			return nil, fmt.Errorf("player %s does not belong to game %s", event.Player, next.ID)
+		}
+		if err := assignRole(next, playerID, event.Role); err != nil {
+			return nil, err
+		}
+		delete(next.TeamRequests, playerID)
+	case db.EventStart:
+		for playerID, playerName := range next.Players {
+			if playerName == next.TeamRedSpy || playerName == next.TeamBlueSpy {
+				next.SpyCounts[playerID]++
+			}
+		}
+		next.Status = "running"
+		next.WhoseTurn = "blue"
+		next.Rounds++
+		next.Cards = map[string]db.Card{}
+		for word, card := range event.Cards {
+			next.Cards[word] = card
+		}
+	case db.EventClue:
+		// Clues are only recorded in the game's history.
+	case db.EventGuess:
+		card, cardFound := next.Cards[event.Word]
+		if !cardFound {
+			return nil, fmt.Errorf("card %s does not belong to game %s", event.Word, next.ID)
+		}
+		card.Guessed = true
+		next.Cards[event.Word] = card
+		next.LastCardGuessed = event.Word
+		next.LastCardGuessedBy = event.Actor
+		next.LastCardGuessedCorrectly = event.Correct
+		if !event.Correct && card.BelongsTo != "black" {
+			next.WhoseTurn = otherTeam(next.WhoseTurn)
+		}
+		scoreGuess(next, event)
+	case db.EventWin:
+		scoreWin(next, event.Team)
+		next.Status = event.Team + "won"
+		next.WhoseTurn = "over"
+	case db.EventEndTurn:
+		endTurn(&next.Scoreboard, next.WhoseTurn)
+		next.WhoseTurn = otherTeam(next.WhoseTurn)
+	case db.EventRestart:
+		next.Cards = map[string]db.Card{}
+		next.Status = "pending"
+		next.WhoseTurn = "blue"
+		next.LastCardGuessed = ""
+		next.LastCardGuessedBy = ""
+		next.LastCardGuessedCorrectly = false
+		next.TimesPlayed++
+		if event.Lineup != nil {
+			applyLineup(next, event.Lineup)
+		}
+	case db.EventUndoPropose:
+		next.UndoProposal = &db.UndoProposal{
+			Target:     event.Target,
+			Word:       event.Word,
+			ProposedAt: event.At,
+			ProposedBy: event.Actor,
+			Votes:      map[string]string{event.ActorID: event.Actor},
+		}
+	case db.EventUndoVote:
+		if next.UndoProposal == nil || next.UndoProposal.Target != event.Target {
+			return nil, fmt.Errorf("no undo of event %d is waiting for votes", event.Target)
+		}
+		next.UndoProposal.Votes[event.ActorID] = event.Actor
+	case db.EventUndoReject:
+		next.UndoProposal = nil
+	case db.EventUndo:
+		return undo(next, event.Target)
+	case db.EventGuessPolicy:
+		next.GuessPolicy = event.Setting
+	case db.EventRotation:
+		next.RotationPolicy = event.Setting
+	case db.EventLineup:
+		if event.Lineup == nil {
+			return nil, errors.New("Received a lineup event without a lineup")
+		}
+		applyLineup(next, event.Lineup)
+		next.TeamRequests = map[string]string{}
+	case db.EventTeamLock:
+		next.TeamsLocked = event.Setting == "locked"
+		if next.TeamsLocked {
+			next.TeamRequests = map[string]string{}
+		}
+	case db.EventAllowTeamRequests:
+		next.AllowTeamRequests = event.Setting == "on"
+		if !next.AllowTeamRequests {
+			next.TeamRequests = map[string]string{}
+		}
+	case db.EventPassword:
+		next.PasswordHash = event.PasswordHash
+		next.SpectatorsNeedPassword = event.PasswordHash != "" && event.Setting == PasswordEveryone
+	case db.EventVisibility:
+		next.Public = event.Setting == VisibilityPublic
+	case db.EventScoreboardReset:
+		next.Scoreboard = newScoreboard()
+	case db.EventTeamRequest:
+		next.TeamRequests[event.ActorID] = event.Role
+	case db.EventTeamDeny:
+		for playerID, playerName := range next.Players {
+			if playerName == event.Player {
+				delete(next.TeamRequests, playerID)
+			}
+		}
+	case db.EventGuessVote:
+		votes := next.TeamRedVotes
+		if event.Team == "blue" {
+			votes = next.TeamBlueVotes
+		}
+		if event.Word == "" {
+			delete(votes, event.ActorID)
+		} else {
+			votes[event.ActorID] = event.Word
+		}
+	default:
+		return nil, fmt.Errorf("unknown event type %s", event.Type)
+	}
+	next.PlayerCount = len(next.Players)
+	return next, nil
+}
+
+// undo rebuilds the game as it was right before the event with the target seq happened, keeping the full history.
+func undo(game *db.Game, target int64) (*db.Game, error) {
+	index := -1
+	for i, event := range game.Events {
+		if event.Seq == target {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("cannot undo unknown event %d", target)
+	}
+	before, err := rebuild(game, index)
+	if err != nil {
+		return nil, err
+	}
+	before.Events = game.Events
+	before.UpdatedAt = game.UpdatedAt
+	before.Version = game.Version
+	return before, nil
+}
+
+func clone(game *db.Game) *db.Game {
+	next := *game
+	next.Players = copyNames(game.Players)
+	next.TeamRed = copyNames(game.TeamRed)
+	next.TeamBlue = copyNames(game.TeamBlue)
+	next.Cards = make(map[string]db.Card, len(game.Cards))
+	for word, card := range game.Cards {
+		next.Cards[word] = card
+	}
+	next.Events = append([]db.Event{}, game.Events...)
+	next.TeamRedVotes = copyNames(game.TeamRedVotes)
+	next.TeamBlueVotes = copyNames(game.TeamBlueVotes)
+	next.TeamRequests = copyNames(game.TeamRequests)
+	next.Scoreboard = copyScoreboard(game.Scoreboard)
+	next.SpyCounts = make(map[string]int, len(game.SpyCounts))
+	for playerID, count := range game.SpyCounts {
+		next.SpyCounts[playerID] = count
+	}
+	if game.UndoProposal != nil {
+		proposal := *game.UndoProposal
+		proposal.Votes = copyNames(game.UndoProposal.Votes)
+		next.UndoProposal = &proposal
+	}
+	return &next
+}
+
+func copyNames(names map[string]string) map[string]string {
+	copied := make(map[string]string, len(names))
+	for playerID, playerName := range names {
+		copied[playerID] = playerName
+	}
+	return copied
+}
+
+func otherTeam(team string) string {
+	if team == "red" {
+		return "blue"
+	}
+	return "red"
+}
+
+func findTeamMember(game *db.Game, playerName string) (string, bool) {
+	for playerID, name := range game.TeamRed {
+		if name == playerName {
+			return playerID, true
+		}
+	}
+	for playerID, name := range game.TeamBlue {
+		if name == playerName {
+			return playerID, true
+		}
+	}
+	return "", false
+}
+
+func validRole(role string) bool {
+	switch role {
+	case "bluespy", "blueguesser", "redspy", "redguesser", "blueobs", "redobs":
+		return true
+	}
+	return false
+}
+
+// assignRole moves a player to the team of the given role and gives them that role.
+func assignRole(game *db.Game, playerID string, role string) error {
+	if !validRole(role) {
+		return fmt.Errorf("unknown role %s", role)
+	}
+	playerName := game.Players[playerID]
+	clearRoles(game, playerName)
+	switch role {
+	case "bluespy":
+		game.TeamBlueSpy = playerName
+	case "blueguesser":
+		game.TeamBlueGuesser = playerName
+	case "redspy":
+		game.TeamRedSpy = playerName
+	case "redguesser":
+		game.TeamRedGuesser = playerName
+	}
+	if strings.HasPrefix(role, "blue") {
+		delete(game.TeamRed, playerID)
+		game.TeamBlue[playerID] = playerName
+	} else {
+		delete(game.TeamBlue, playerID)
+		game.TeamRed[playerID] = playerName
+	}
+	return nil
+}
+
+func clearRoles(game *db.Game, playerName string) {
+	if game.TeamRedSpy == playerName {
+		game.TeamRedSpy = ""
+	} else if game.TeamRedGuesser == playerName {
+		game.TeamRedGuesser = ""
+	} else if game.TeamBlueSpy == playerName {
+		game.TeamBlueSpy = ""
+	} else if game.TeamBlueGuesser == playerName {
+		game.TeamBlueGuesser = ""
+	}
+}
+
+func renamePlayer(game *db.Game, playerID string, oldName string, newName string) {
+	game.Players[playerID] = newName
+	if _, ok := game.TeamRed[playerID]; ok {
+		game.TeamRed[playerID] = newName
+	}
+	if _, ok := game.TeamBlue[playerID]; ok {
+		game.TeamBlue[playerID] = newName
+	}
+	for _, role := range []*string{&game.TeamRedSpy, &game.TeamRedGuesser, &game.TeamBlueSpy, &game.TeamBlueGuesser} {
+		if *role == oldName {
+			*role = newName
+		}
+	}
+}
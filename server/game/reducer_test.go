@@ -0,0 +1,381 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+var testCards = map[string]db.Card{
+	"ocean": {Index: 0, BelongsTo: "blue"},
+	"whale": {Index: 1, BelongsTo: "red"},
+	"bomb":  {Index: 2, BelongsTo: "black"},
+	"tree":  {Index: 3, BelongsTo: ""},
+}
+
+// lobby is the log of a game with a full team on each side.
+var lobby = []db.Event{
+	{Type: db.EventJoin, ActorID: "p1", Actor: "ann", Role: "bluespy"},
+	{Type: db.EventJoin, ActorID: "p2", Actor: "bob", Role: "blueguesser"},
+	{Type: db.EventJoin, ActorID: "p3", Actor: "cat", Role: "redspy"},
+	{Type: db.EventJoin, ActorID: "p4", Actor: "dan", Role: "redguesser"},
+}
+
+var start = db.Event{Type: db.EventStart, ActorID: "p1", Actor: "ann", Cards: testCards}
+
+// play creates a game from events, numbering them the way db.CreateGame does.
+func play(t *testing.T, events ...db.Event) *db.Game {
+	t.Helper()
+	numbered := make([]db.Event, len(events))
+	for i, event := range events {
+		event.Seq = int64(i + 1)
+		numbered[i] = event
+	}
+	game, err := Create("game", numbered)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return game
+}
+
+func guess(actorID string, actor string, team string, word string) db.Event {
+	card := testCards[word]
+	return db.Event{Type: db.EventGuess, ActorID: actorID, Actor: actor, Team: team, Word: word, BelongsTo: card.BelongsTo, Correct: card.BelongsTo == team}
+}
+
+func TestReduce(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []db.Event
+		check  func(t *testing.T, game *db.Game)
+	}{
+		{"first player hosts", lobby, func(t *testing.T, game *db.Game) {
+			if game.CreatorID != "p1" || game.PlayerCount != 4 || game.TeamBlueSpy != "ann" || game.TeamRedGuesser != "dan" {
+				t.Errorf("creator %s, %d players, blue spy %s, red guesser %s", game.CreatorID, game.PlayerCount, game.TeamBlueSpy, game.TeamRedGuesser)
+			}
+		}},
+		{"joining again renames", append(append([]db.Event{}, lobby...), db.Event{Type: db.EventJoin, ActorID: "p3", Actor: "cathy"}), func(t *testing.T, game *db.Game) {
+			if game.Players["p3"] != "cathy" || game.TeamRed["p3"] != "cathy" || game.TeamRedSpy != "cathy" || game.PlayerCount != 4 {
+				t.Errorf("players %v, red spy %s", game.Players, game.TeamRedSpy)
+			}
+		}},
+		{"team change", append(append([]db.Event{}, lobby...), db.Event{Type: db.EventTeamChange, Player: "bob", Role: "redobs"}), func(t *testing.T, game *db.Game) {
+			if _, onRed := game.TeamRed["p2"]; !onRed || game.TeamBlueGuesser != "" {
+				t.Errorf("red %v, blue guesser %s", game.TeamRed, game.TeamBlueGuesser)
+			}
+		}},
+		{"start", append(append([]db.Event{}, lobby...), start), func(t *testing.T, game *db.Game) {
+			if game.Status != "running" || game.WhoseTurn != "blue" || game.Rounds != 1 || len(game.Cards) != len(testCards) {
+				t.Errorf("status %s, turn %s, round %d, %d cards", game.Status, game.WhoseTurn, game.Rounds, len(game.Cards))
+			}
+			if game.SpyCounts["p1"] != 1 || game.SpyCounts["p3"] != 1 || game.SpyCounts["p2"] != 0 {
+				t.Errorf("spy counts %v", game.SpyCounts)
+			}
+		}},
+		{"correct guess keeps the turn", append(append([]db.Event{}, lobby...), start, guess("p2", "bob", "blue", "ocean")), func(t *testing.T, game *db.Game) {
+			if !game.Cards["ocean"].Guessed || game.WhoseTurn != "blue" || !game.LastCardGuessedCorrectly || game.Scoreboard.BlueCardsGuessed != 1 {
+				t.Errorf("card %v, turn %s, scoreboard %+v", game.Cards["ocean"], game.WhoseTurn, game.Scoreboard)
+			}
+		}},
+		{"wrong guess ends the turn", append(append([]db.Event{}, lobby...), start, guess("p2", "bob", "blue", "tree")), func(t *testing.T, game *db.Game) {
+			if game.WhoseTurn != "red" || game.Scoreboard.BlueTurns != 1 {
+				t.Errorf("turn %s, scoreboard %+v", game.WhoseTurn, game.Scoreboard)
+			}
+		}},
+		{"assassin", append(append([]db.Event{}, lobby...), start, guess("p2", "bob", "blue", "bomb"), db.Event{Type: db.EventWin, Team: "red"}), func(t *testing.T, game *db.Game) {
+			if game.Status != "redwon" || game.WhoseTurn != "over" || game.Scoreboard.Players["p2"].AssassinHits != 1 || game.Scoreboard.RedWins != 1 {
+				t.Errorf("status %s, turn %s, scoreboard %+v", game.Status, game.WhoseTurn, game.Scoreboard)
+			}
+		}},
+		{"end turn", append(append([]db.Event{}, lobby...), start, db.Event{Type: db.EventEndTurn}), func(t *testing.T, game *db.Game) {
+			if game.WhoseTurn != "red" || game.Scoreboard.BlueTurns != 1 {
+				t.Errorf("turn %s, scoreboard %+v", game.WhoseTurn, game.Scoreboard)
+			}
+		}},
+		{"restart", append(append([]db.Event{}, lobby...), start, db.Event{Type: db.EventWin, Team: "blue"}, db.Event{Type: db.EventRestart}), func(t *testing.T, game *db.Game) {
+			if game.Status != "pending" || len(game.Cards) != 0 || game.TimesPlayed != 1 || game.Scoreboard.BlueWins != 1 {
+				t.Errorf("status %s, %d cards, played %d, scoreboard %+v", game.Status, len(game.Cards), game.TimesPlayed, game.Scoreboard)
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := play(t, test.events...)
+			if len(game.Events) != len(test.events) {
+				t.Errorf("%d events in the log, want %d", len(game.Events), len(test.events))
+			}
+			test.check(t, game)
+		})
+	}
+}
+
+func TestReduceErrors(t *testing.T) {
+	game := play(t, append(append([]db.Event{}, lobby...), start)...)
+	tests := []struct {
+		name  string
+		event db.Event
+	}{
+		{"unknown event", db.Event{Type: "dance"}},
+		{"unknown card", db.Event{Type: db.EventGuess, Word: "moon"}},
+		{"unknown role", db.Event{Type: db.EventJoin, ActorID: "p5", Actor: "eve", Role: "captain"}},
+		{"team change of a stranger", db.Event{Type: db.EventTeamChange, Player: "eve", Role: "redobs"}},
+		{"vote without a proposal", db.Event{Type: db.EventUndoVote, Target: 6}},
+		{"undo of an unknown event", db.Event{Type: db.EventUndo, Target: 42}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Reduce(game, test.event); err == nil {
+				t.Error("Reduce succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestReduceLeavesGameAlone(t *testing.T) {
+	game := play(t, append(append([]db.Event{}, lobby...), start)...)
+	before := clone(game)
+	if _, err := Reduce(game, guess("p2", "bob", "blue", "tree")); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(game, before) {
+		t.Error("Reduce modified the game it was given")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	events := append(append([]db.Event{}, lobby...), start, guess("p2", "bob", "blue", "ocean"), guess("p2", "bob", "blue", "tree"))
+	game := play(t, events...)
+	target := game.Events[len(game.Events)-1].Seq
+
+	undone, err := Reduce(game, db.Event{Type: db.EventUndo, Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone.Cards["tree"].Guessed || !undone.Cards["ocean"].Guessed || undone.WhoseTurn != "blue" || undone.Scoreboard.BlueTurns != 0 {
+		t.Errorf("cards %v, turn %s, scoreboard %+v", undone.Cards, undone.WhoseTurn, undone.Scoreboard)
+	}
+	if len(undone.Events) != len(game.Events) || undone.Checkpoint != game.Checkpoint {
+		t.Error("undo has to keep the history and the checkpoint")
+	}
+
+	legacy := clone(game)
+	legacy.Checkpoint = nil
+	now := time.Now()
+	legacy.Events[len(legacy.Events)-1].At = now.UnixNano() / int64(time.Millisecond)
+	if events := decideProposeUndo(legacy, "p1", now); len(events) != 0 {
+		t.Errorf("undo was proposed in a game older than its history: %v", events)
+	}
+	if _, err := Reduce(legacy, db.Event{Type: db.EventUndo, Target: target}); err != ErrHistoryIncomplete {
+		t.Errorf("undo without a checkpoint: %v, want %v", err, ErrHistoryIncomplete)
+	}
+}
+
+func TestCompactKeepsTheGameRebuildable(t *testing.T) {
+	events := append([]db.Event{}, lobby...)
+	events = append(events, start, guess("p2", "bob", "blue", "ocean"), db.Event{Type: db.EventWin, Team: "blue"}, db.Event{Type: db.EventRestart})
+	events = append(events, start, guess("p2", "bob", "blue", "ocean"), guess("p2", "bob", "blue", "tree"))
+	game := play(t, events...)
+	target := game.Events[len(game.Events)-1].Seq
+
+	compacted, err := db.Compact(clone(game), 4, Reduce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second round's start is the last one within the limit, the log is cut right before it.
+	if len(compacted.Events) != 3 || compacted.Events[0].Type != db.EventStart || compacted.Checkpoint.Rounds != 1 {
+		t.Fatalf("%d events starting with %s, checkpoint after round %d", len(compacted.Events), compacted.Events[0].Type, compacted.Checkpoint.Rounds)
+	}
+	if compacted.Checkpoint.Checkpoint != nil || len(compacted.Checkpoint.Events) != 0 {
+		t.Error("the checkpoint must not carry a history of its own")
+	}
+	rebuilt, err := rebuild(compacted, len(compacted.Events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt.Events, game.Events = nil, nil
+	rebuilt.Checkpoint, game.Checkpoint = nil, nil
+	if !reflect.DeepEqual(rebuilt, game) {
+		t.Errorf("rebuilt %+v, want %+v", rebuilt, game)
+	}
+	undone, err := Reduce(compacted, db.Event{Type: db.EventUndo, Target: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if undone.Cards["tree"].Guessed || undone.WhoseTurn != "blue" {
+		t.Errorf("undo after compacting: cards %v, turn %s", undone.Cards, undone.WhoseTurn)
+	}
+	// Rounds keep their numbers once the ones before them are gone.
+	compacted.Events = append(compacted.Events, db.Event{Seq: target + 1, Type: db.EventWin, Team: "red"})
+	if rounds := finishedRounds(compacted); len(rounds) != 1 || rounds[0].number != 2 {
+		t.Errorf("finished rounds %+v, want round 2 only", rounds)
+	}
+}
+
+// commitAll folds events into game one at a time the way db.CommitEvents does, numbering them after its log.
+func commitAll(t *testing.T, game *db.Game, events ...db.Event) *db.Game {
+	t.Helper()
+	for _, event := range events {
+		event.Seq = game.Events[len(game.Events)-1].Seq + 1
+		next, err := Reduce(game, event)
+		if err != nil {
+			t.Fatalf("Reduce %s: %v", event.Type, err)
+		}
+		next.Events = append(next.Events, event)
+		game = next
+	}
+	return game
+}
+
+func TestUndoTwice(t *testing.T) {
+	game := play(t, append(append([]db.Event{}, lobby...), start, guess("p2", "bob", "blue", "ocean"))...)
+	game = commitAll(t, game, db.Event{Type: db.EventUndo, Target: game.Events[len(game.Events)-1].Seq})
+	if game.Cards["ocean"].Guessed {
+		t.Fatal("the first undo didn't take the guess back")
+	}
+	game = commitAll(t, game, guess("p2", "bob", "blue", "ocean"), guess("p2", "bob", "blue", "tree"))
+	game = commitAll(t, game, db.Event{Type: db.EventUndo, Target: game.Events[len(game.Events)-1].Seq})
+	if game.Cards["tree"].Guessed || !game.Cards["ocean"].Guessed || game.WhoseTurn != "blue" {
+		t.Errorf("cards %v, turn %s after the second undo", game.Cards, game.WhoseTurn)
+	}
+	rebuilt, err := Replay(game.Checkpoint, game.Events)
+	if err != nil {
+		t.Fatalf("Replay: %v", err)
+	}
+	if !reflect.DeepEqual(rebuilt.Cards, game.Cards) || rebuilt.WhoseTurn != game.WhoseTurn || !reflect.DeepEqual(rebuilt.Scoreboard, game.Scoreboard) {
+		t.Errorf("replaying the log gives cards %v, turn %s, want %v, %s", rebuilt.Cards, rebuilt.WhoseTurn, game.Cards, game.WhoseTurn)
+	}
+}
+
+func TestCompactPastUndo(t *testing.T) {
+	game := play(t, append(append([]db.Event{}, lobby...), start, guess("p2", "bob", "blue", "ocean"))...)
+	game = commitAll(t, game, db.Event{Type: db.EventUndo, Target: game.Events[len(game.Events)-1].Seq})
+	game = commitAll(t, game, guess("p2", "bob", "blue", "ocean"), guess("p2", "bob", "blue", "tree"))
+	undoTarget := game.Events[len(game.Events)-1].Seq
+	game = commitAll(t, game, db.Event{Type: db.EventEndTurn})
+
+	tests := []struct {
+		name  string
+		limit int
+		keep  int // events left in the log
+	}{
+		// The first undo is folded into the checkpoint together with the guess it took back.
+		{"undo folded", 3, 3},
+		// Cutting between the first guess and its undo would leave the undo without its target.
+		{"undo kept with its target", 4, 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			compacted, err := db.Compact(clone(game), test.limit, Reduce)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(compacted.Events) != test.keep {
+				t.Fatalf("%d events left, want %d", len(compacted.Events), test.keep)
+			}
+			rebuilt, err := rebuild(compacted, len(compacted.Events))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(rebuilt.Cards, game.Cards) || rebuilt.WhoseTurn != game.WhoseTurn {
+				t.Errorf("rebuilt cards %v, turn %s, want %v, %s", rebuilt.Cards, rebuilt.WhoseTurn, game.Cards, game.WhoseTurn)
+			}
+		})
+	}
+
+	// An undo whose target would be folded keeps the log from being cut after the target.
+	undone := commitAll(t, game, db.Event{Type: db.EventUndo, Target: undoTarget})
+	compacted, err := db.Compact(clone(undone), 1, Reduce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compacted.Events[0].Seq > undoTarget {
+		t.Fatalf("the log starts at %d, after the undone guess %d", compacted.Events[0].Seq, undoTarget)
+	}
+	again := commitAll(t, compacted, guess("p2", "bob", "blue", "tree"))
+	if _, err := Reduce(again, db.Event{Type: db.EventUndo, Target: again.Events[len(again.Events)-1].Seq}); err != nil {
+		t.Errorf("undo after compacting: %v", err)
+	}
+}
+
+func TestCompactEveryEventType(t *testing.T) {
+	lineup := &db.Lineup{
+		TeamRed:        map[string]string{"p3": "cat", "p2": "bob"},
+		TeamBlue:       map[string]string{"p1": "ann", "p4": "dan"},
+		TeamRedSpy:     "cat",
+		TeamBlueSpy:    "ann",
+		TeamRedGuesser: "bob", TeamBlueGuesser: "dan",
+	}
+	game := play(t, lobby...)
+	game = commitAll(t, game,
+		db.Event{Type: db.EventJoin, ActorID: "p4", Actor: "dan"},
+		db.Event{Type: db.EventAllowTeamRequests, Setting: "on"},
+		db.Event{Type: db.EventTeamRequest, ActorID: "p2", Actor: "bob", Role: "redguesser"},
+		db.Event{Type: db.EventTeamDeny, Player: "bob"},
+		db.Event{Type: db.EventTeamLock, Setting: "locked"},
+		db.Event{Type: db.EventTeamLock, Setting: "unlocked"},
+		db.Event{Type: db.EventPassword, PasswordHash: "hash", Setting: PasswordEveryone},
+		db.Event{Type: db.EventVisibility, Setting: VisibilityPublic},
+		db.Event{Type: db.EventRotation, Setting: RotationSwap},
+		db.Event{Type: db.EventGuessPolicy, Setting: GuessPolicyVote},
+		db.Event{Type: db.EventTeamChange, Player: "bob", Role: "blueobs"},
+		db.Event{Type: db.EventLineup, Lineup: lineup},
+		start,
+		db.Event{Type: db.EventClue, ActorID: "p1", Actor: "ann", Word: "sea", Count: 1},
+		db.Event{Type: db.EventGuessVote, ActorID: "p4", Actor: "dan", Team: "blue", Word: "ocean"},
+		guess("p4", "dan", "blue", "ocean"),
+	)
+	target := game.Events[len(game.Events)-1].Seq
+	game = commitAll(t, game,
+		db.Event{Type: db.EventUndoPropose, ActorID: "p4", Actor: "dan", Target: target, Word: "ocean"},
+		db.Event{Type: db.EventUndoVote, ActorID: "p1", Actor: "ann", Target: target},
+		db.Event{Type: db.EventUndo, Target: target},
+		guess("p4", "dan", "blue", "ocean"),
+	)
+	target = game.Events[len(game.Events)-1].Seq
+	game = commitAll(t, game,
+		db.Event{Type: db.EventUndoPropose, ActorID: "p4", Actor: "dan", Target: target, Word: "ocean"},
+		db.Event{Type: db.EventUndoReject},
+		guess("p4", "dan", "blue", "tree"),
+		db.Event{Type: db.EventEndTurn},
+		guess("p4", "dan", "blue", "bomb"),
+		db.Event{Type: db.EventWin, Team: "red"},
+		db.Event{Type: db.EventRestart, Lineup: lineup},
+		db.Event{Type: db.EventScoreboardReset},
+		start,
+		guess("p4", "dan", "blue", "whale"),
+	)
+
+	types := map[string]bool{}
+	for _, event := range game.Events {
+		types[event.Type] = true
+	}
+	for _, eventType := range []string{
+		db.EventJoin, db.EventTeamChange, db.EventStart, db.EventClue, db.EventGuess, db.EventEndTurn, db.EventWin,
+		db.EventRestart, db.EventUndoPropose, db.EventUndoVote, db.EventUndoReject, db.EventUndo, db.EventGuessPolicy,
+		db.EventGuessVote, db.EventRotation, db.EventLineup, db.EventTeamLock, db.EventTeamRequest, db.EventTeamDeny,
+		db.EventAllowTeamRequests, db.EventScoreboardReset, db.EventPassword, db.EventVisibility,
+	} {
+		if !types[eventType] {
+			t.Errorf("the log has no %s event", eventType)
+		}
+	}
+
+	want := clone(game)
+	want.Events, want.Checkpoint = nil, nil
+	for limit := 1; limit < len(game.Events); limit++ {
+		compacted, err := db.Compact(clone(game), limit, Reduce)
+		if err != nil {
+			t.Fatalf("Compact to %d events: %v", limit, err)
+		}
+		rebuilt, err := rebuild(compacted, len(compacted.Events))
+		if err != nil {
+			t.Fatalf("rebuilding after compacting to %d events: %v", limit, err)
+		}
+		rebuilt.Events, rebuilt.Checkpoint = nil, nil
+		if !reflect.DeepEqual(rebuilt, want) {
+			t.Errorf("compacted to %d events, rebuilt %+v, want %+v", limit, rebuilt, want)
+		}
+	}
+}
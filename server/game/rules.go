@@ -0,0 +1,480 @@
+package game
+
+import (
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/data"
+	"github.com/RobertDHanna/OpenCodenames/db"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// decideJoin determines which team and role a joining player gets.
+func decideJoin(game *db.Game, playerID string, playerName string) ([]db.Event, error) {
+	if _, playerFound := game.Players[playerID]; playerFound {
+		if game.Status == "pending" {
+			// Overwrite player name
+			return []db.Event{{Type: db.EventJoin, ActorID: playerID, Actor: playerName}}, nil
+		}
+		return nil, ErrPlayerAlreadyAdded
+	}
+	for _, otherPlayerName := range game.Players {
+		if playerName == otherPlayerName {
+			return nil, ErrNameAlreadyTaken
+		}
+	}
+	if len(game.Players) >= config.PlayerLimit() {
+		return nil, ErrGameIsFull
+	}
+	if game.Status != "pending" {
+		return nil, ErrGameAlreadyStarted
+	}
+	joinEvent := db.Event{Type: db.EventJoin, ActorID: playerID, Actor: playerName}
+	// Try to put player on a team and in a role...
+	if len(game.Players) == 0 || game.TeamBlueSpy == "" {
+		joinEvent.Role = "bluespy"
+	} else if game.TeamBlueGuesser == "" {
+		joinEvent.Role = "blueguesser"
+	} else if game.TeamRedSpy == "" {
+		joinEvent.Role = "redspy"
+	} else if game.TeamRedGuesser == "" {
+		joinEvent.Role = "redguesser"
+	} else if len(game.TeamBlue) < len(game.TeamRed) {
+		joinEvent.Role = "blueobs"
+	} else {
+		joinEvent.Role = "redobs"
+	}
+	return []db.Event{joinEvent}, nil
+}
+
+// decideStart deals a new board if the game's creator asked to start a game that is ready.
+func decideStart(game *db.Game, playerID string) []db.Event {
+	if game.Status != "pending" || len(game.Players) < 4 || game.CreatorID != playerID {
+		return nil
+	}
+	if game.TeamBlueSpy == "" || game.TeamBlueGuesser == "" || game.TeamRedSpy == "" || game.TeamRedGuesser == "" {
+		log.Println("Game cannot start, required roles are not filled")
+		return nil
+	}
+	log.Println("Starting Game", game.ID)
+	return []db.Event{{Type: db.EventStart, ActorID: playerID, Actor: game.Players[playerID], Cards: newBoard()}}
+}
+
+// newBoard chooses 25 words and assigns 9 to blue, 8 to red and 1 to the bomb.
+func newBoard() map[string]db.Card {
+	wordList := data.GetWordList()
+	chosenWords := make([]string, 0, 25)
+	for {
+		randomWord := wordList[rand.Intn(len(wordList))]
+		if _, contains := utils.Contains(chosenWords, randomWord); contains {
+			continue
+		}
+		chosenWords = append(chosenWords, randomWord)
+		if len(chosenWords) == 25 {
+			break
+		}
+	}
+	cards := map[string]db.Card{}
+	i := 0
+	for _, word := range chosenWords {
+		cards[word] = db.Card{BelongsTo: "", Guessed: false, Index: i}
+		i++
+	}
+	teamRedWords := make([]string, 0, 9)
+	teamBlueWords := make([]string, 0, 8)
+	// Select the bomb card
+	blackWord := chosenWords[rand.Intn(len(chosenWords))]
+	if card, ok := cards[blackWord]; ok {
+		cards[blackWord] = db.Card{BelongsTo: "black", Guessed: false, Index: card.Index}
+	}
+	// Select red cards
+	for j := 0; j < 8; j++ {
+		randomWord := ""
+		for {
+			randomWord = chosenWords[rand.Intn(len(chosenWords))]
+			if randomWord == blackWord {
+				continue
+			}
+			if _, contains := utils.Contains(teamRedWords, randomWord); contains {
+				continue
+			}
+			teamRedWords = append(teamRedWords, randomWord)
+			break
+		}
+		if card, ok := cards[randomWord]; ok {
+			cards[randomWord] = db.Card{BelongsTo: "red", Guessed: false, Index: card.Index}
+		} else {
+			log.Println("red not found", randomWord)
+		}
+	}
+	// Select blue cards
+	for j := 0; j < 9; j++ {
+		randomWord := ""
+		for {
+			randomWord = chosenWords[rand.Intn(len(chosenWords))]
+			if randomWord == blackWord {
+				continue
+			}
+			if _, contains := utils.Contains(teamBlueWords, randomWord); contains {
+				continue
+			}
+			if _, contains := utils.Contains(teamRedWords, randomWord); contains {
+				continue
+			}
+			teamBlueWords = append(teamBlueWords, randomWord)
+			break
+		}
+		if card, ok := cards[randomWord]; ok {
+			cards[randomWord] = db.Card{BelongsTo: "blue", Guessed: false, Index: card.Index}
+		} else {
+			log.Println("blue not found", randomWord)
+		}
+	}
+	return cards
+}
+
+// decideGuess flips the guessed card and, if the guess ends the game, declares the winner. When the team
+// votes on its guesses the card is only flipped once most of its connected operatives voted for it.
+func decideGuess(game *db.Game, playerID string, word string, connected map[string]bool) ([]db.Event, error) {
+	if !playerCanGuess(game, playerID) {
+		return nil, nil
+	}
+	card, cardFound := game.Cards[word]
+	if !cardFound || card.Guessed {
+		return nil, nil
+	}
+	if game.GuessPolicy != GuessPolicyVote {
+		return guessEvents(game, playerID, word)
+	}
+	votes := game.TeamBlueVotes
+	teamMembers := game.TeamBlue
+	spy := game.TeamBlueSpy
+	if game.WhoseTurn == "red" {
+		votes = game.TeamRedVotes
+		teamMembers = game.TeamRed
+		spy = game.TeamRedSpy
+	}
+	voteEvent := db.Event{Type: db.EventGuessVote, ActorID: playerID, Actor: game.Players[playerID], Team: game.WhoseTurn, Word: word}
+	if votes[playerID] == word {
+		// Picking the same card twice takes the vote back.
+		voteEvent.Word = ""
+		return []db.Event{voteEvent}, nil
+	}
+	operatives := 0
+	votesForWord := 0
+	for memberID, memberName := range teamMembers {
+		if memberName == spy || (!connected[memberID] && memberID != playerID) {
+			continue
+		}
+		operatives++
+		if memberID == playerID || votes[memberID] == word {
+			votesForWord++
+		}
+	}
+	if votesForWord*2 <= operatives {
+		return []db.Event{voteEvent}, nil
+	}
+	events, err := guessEvents(game, playerID, word)
+	if err != nil {
+		return nil, err
+	}
+	return append([]db.Event{voteEvent}, events...), nil
+}
+
+// guessEvents flips the guessed card and, if the guess ends the game, declares the winner.
+func guessEvents(game *db.Game, playerID string, word string) ([]db.Event, error) {
+	card := game.Cards[word]
+	events := []db.Event{{
+		Type:      db.EventGuess,
+		ActorID:   playerID,
+		Actor:     game.Players[playerID],
+		Team:      game.WhoseTurn,
+		Word:      word,
+		BelongsTo: card.BelongsTo,
+		Correct:   card.BelongsTo == game.WhoseTurn,
+	}}
+	next, err := Reduce(game, events[0])
+	if err != nil {
+		return nil, err
+	}
+	if winner := winningTeam(next, card, game.WhoseTurn); winner != "" {
+		events = append(events, db.Event{Type: db.EventWin, Team: winner})
+	}
+	return events, nil
+}
+
+// winningTeam returns the team that won after card was guessed by guessingTeam, if any.
+func winningTeam(game *db.Game, card db.Card, guessingTeam string) string {
+	if card.BelongsTo == "black" {
+		return otherTeam(guessingTeam)
+	}
+	redCardsGuessed := 0
+	blueCardsGuessed := 0
+	for _, card := range game.Cards {
+		if !card.Guessed {
+			continue
+		}
+		if card.BelongsTo == "blue" {
+			blueCardsGuessed++
+		} else if card.BelongsTo == "red" {
+			redCardsGuessed++
+		}
+	}
+	if blueCardsGuessed == 9 {
+		return "blue"
+	}
+	if redCardsGuessed == 8 {
+		return "red"
+	}
+	return ""
+}
+
+// decideEndTurn passes the turn to the other team.
+func decideEndTurn(game *db.Game, playerID string) []db.Event {
+	if !playerCanEndTurn(game, playerID) {
+		return nil
+	}
+	return []db.Event{{Type: db.EventEndTurn, ActorID: playerID, Actor: game.Players[playerID], Team: game.WhoseTurn}}
+}
+
+// decideClue records a clue given by the spy of the active team.
+func decideClue(game *db.Game, playerID string, word string, count int) []db.Event {
+	if !playerCanGiveClue(game, playerID) {
+		return nil
+	}
+	return []db.Event{{
+		Type:    db.EventClue,
+		ActorID: playerID,
+		Actor:   game.Players[playerID],
+		Team:    game.WhoseTurn,
+		Word:    word,
+		Count:   count,
+	}}
+}
+
+// decideRestart sends a finished game back to the lobby.
+func decideRestart(game *db.Game, playerID string) []db.Event {
+	if game.WhoseTurn != "over" {
+		return nil
+	}
+	return []db.Event{{Type: db.EventRestart, ActorID: playerID, Actor: game.Players[playerID], Lineup: nextLineup(game)}}
+}
+
+// decideTeamChange moves a player to a new team/role if the requester is allowed to.
+func decideTeamChange(game *db.Game, playerID string, requestedPlayerName string, newRole string) []db.Event {
+	if !playerCanUpdateTeams(game, playerID) {
+		return nil
+	}
+	if _, playerFound := findTeamMember(game, requestedPlayerName); !playerFound {
+		log.Println("Update teams received a player that doesn't belong to game: ", game.ID)
+		return nil
+	}
+	if !validRole(newRole) {
+		log.Println("Update teams received an unknown role: ", newRole)
+		return nil
+	}
+	return []db.Event{{
+		Type:    db.EventTeamChange,
+		ActorID: playerID,
+		Actor:   game.Players[playerID],
+		Player:  requestedPlayerName,
+		Role:    newRole,
+	}}
+}
+
+// lastUndoableGuess returns the guess that can still be undone, if the last move of the game was a guess. Games older
+// than the event log can't be rebuilt, so nothing can be undone in them.
+func lastUndoableGuess(game *db.Game, now time.Time) (*db.Event, bool) {
+	if (game.Status != "running" && game.WhoseTurn != "over") || game.Checkpoint == nil {
+		return nil, false
+	}
+	for i := len(game.Events) - 1; i >= 0; i-- {
+		event := game.Events[i]
+		switch event.Type {
+		case db.EventWin, db.EventUndoPropose, db.EventUndoVote, db.EventUndoReject:
+			continue
+		case db.EventGuess:
+			guessedAt := time.Unix(0, event.At*int64(time.Millisecond))
+			if now.Sub(guessedAt) > config.UndoWindow() {
+				return nil, false
+			}
+			return &event, true
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// undoApproved reports whether the host approved the undo or a majority of players voted for it.
+func undoApproved(game *db.Game, votes map[string]string) bool {
+	if _, hostVoted := votes[game.CreatorID]; hostVoted {
+		return true
+	}
+	return len(votes)*2 > len(game.Players)
+}
+
+// decideProposeUndo opens a vote to undo the last guess, undoing it right away if the host proposed it.
+func decideProposeUndo(game *db.Game, playerID string, now time.Time) []db.Event {
+	playerName, playerFound := game.Players[playerID]
+	if !playerFound {
+		return nil
+	}
+	guess, undoable := lastUndoableGuess(game, now)
+	if !undoable {
+		return nil
+	}
+	if game.UndoProposal != nil && game.UndoProposal.Target == guess.Seq {
+		return decideVoteUndo(game, playerID, now)
+	}
+	events := []db.Event{{Type: db.EventUndoPropose, ActorID: playerID, Actor: playerName, Target: guess.Seq, Word: guess.Word}}
+	if undoApproved(game, map[string]string{playerID: playerName}) {
+		events = append(events, db.Event{Type: db.EventUndo, ActorID: playerID, Actor: playerName, Target: guess.Seq, Word: guess.Word})
+	}
+	return events
+}
+
+// decideVoteUndo adds a player's vote to the pending undo and undoes the guess once it is approved.
+func decideVoteUndo(game *db.Game, playerID string, now time.Time) []db.Event {
+	playerName, playerFound := game.Players[playerID]
+	if !playerFound || game.UndoProposal == nil {
+		return nil
+	}
+	guess, undoable := lastUndoableGuess(game, now)
+	if !undoable || guess.Seq != game.UndoProposal.Target {
+		return nil
+	}
+	if _, alreadyVoted := game.UndoProposal.Votes[playerID]; alreadyVoted {
+		return nil
+	}
+	events := []db.Event{{Type: db.EventUndoVote, ActorID: playerID, Actor: playerName, Target: guess.Seq, Word: guess.Word}}
+	votes := copyNames(game.UndoProposal.Votes)
+	votes[playerID] = playerName
+	if undoApproved(game, votes) {
+		events = append(events, db.Event{Type: db.EventUndo, ActorID: playerID, Actor: playerName, Target: guess.Seq, Word: guess.Word})
+	}
+	return events
+}
+
+// decideRejectUndo lets the host turn down a pending undo.
+func decideRejectUndo(game *db.Game, playerID string) []db.Event {
+	if game.UndoProposal == nil || game.CreatorID != playerID {
+		return nil
+	}
+	return []db.Event{{
+		Type:    db.EventUndoReject,
+		ActorID: playerID,
+		Actor:   game.Players[playerID],
+		Target:  game.UndoProposal.Target,
+		Word:    game.UndoProposal.Word,
+	}}
+}
+
+// decideGuessPolicy lets the host choose how teams guess before the game starts.
+func decideGuessPolicy(game *db.Game, playerID string, policy string) []db.Event {
+	if !playerIsHostInLobby(game, playerID) || game.GuessPolicy == policy {
+		return nil
+	}
+	return []db.Event{{Type: db.EventGuessPolicy, ActorID: playerID, Actor: game.Players[playerID], Setting: policy}}
+}
+
+// decideRotationPolicy lets the host choose how spies change between rounds.
+func decideRotationPolicy(game *db.Game, playerID string, policy string) []db.Event {
+	if game.CreatorID != playerID || game.Status == "running" || game.RotationPolicy == policy {
+		return nil
+	}
+	return []db.Event{{Type: db.EventRotation, ActorID: playerID, Actor: game.Players[playerID], Setting: policy}}
+}
+
+// decideShuffleTeams randomizes the teams, or only evens out their sizes when balance is set.
+func decideShuffleTeams(game *db.Game, playerID string, balance bool) []db.Event {
+	if !playerCanUpdateTeams(game, playerID) {
+		return nil
+	}
+	event := db.Event{Type: db.EventLineup, ActorID: playerID, Actor: game.Players[playerID]}
+	if balance {
+		event.Setting = "balance"
+		event.Lineup = balancedLineup(game)
+	} else {
+		event.Setting = "random"
+		event.Lineup = shuffledLineup(game, false)
+	}
+	return []db.Event{event}
+}
+
+// decideLockTeams freezes or unfreezes the teams.
+func decideLockTeams(game *db.Game, playerID string, locked bool) []db.Event {
+	if !playerIsHostInLobby(game, playerID) || game.TeamsLocked == locked {
+		return nil
+	}
+	setting := "unlocked"
+	if locked {
+		setting = "locked"
+	}
+	return []db.Event{{Type: db.EventTeamLock, ActorID: playerID, Actor: game.Players[playerID], Setting: setting}}
+}
+
+// decideAllowTeamRequests turns team requests on or off.
+func decideAllowTeamRequests(game *db.Game, playerID string, allowed bool) []db.Event {
+	if !playerIsHostInLobby(game, playerID) || game.AllowTeamRequests == allowed {
+		return nil
+	}
+	setting := "off"
+	if allowed {
+		setting = "on"
+	}
+	return []db.Event{{Type: db.EventAllowTeamRequests, ActorID: playerID, Actor: game.Players[playerID], Setting: setting}}
+}
+
+// decideRequestTeam records a player's wish to change team/role. The host's own requests need no approval.
+func decideRequestTeam(game *db.Game, playerID string, role string) []db.Event {
+	playerName, playerFound := game.Players[playerID]
+	if !playerFound || game.Status != "pending" || game.TeamsLocked {
+		return nil
+	}
+	if game.CreatorID == playerID {
+		return decideTeamChange(game, playerID, playerName, role)
+	}
+	if !game.AllowTeamRequests || game.TeamRequests[playerID] == role {
+		return nil
+	}
+	return []db.Event{{Type: db.EventTeamRequest, ActorID: playerID, Actor: playerName, Role: role}}
+}
+
+// decideAnswerTeamRequest moves the requesting player if the host approved the request, or drops it.
+func decideAnswerTeamRequest(game *db.Game, playerID string, requestedPlayerName string, approved bool) []db.Event {
+	if !playerCanUpdateTeams(game, playerID) {
+		return nil
+	}
+	for requesterID, role := range game.TeamRequests {
+		if game.Players[requesterID] != requestedPlayerName {
+			continue
+		}
+		if approved {
+			return decideTeamChange(game, playerID, requestedPlayerName, role)
+		}
+		return []db.Event{{Type: db.EventTeamDeny, ActorID: playerID, Actor: game.Players[playerID], Player: requestedPlayerName}}
+	}
+	return nil
+}
+
+// decideResetScoreboard lets the host start a new tally between rounds.
+func decideResetScoreboard(game *db.Game, playerID string) []db.Event {
+	if game.CreatorID != playerID || game.Status == "running" {
+		return nil
+	}
+	return []db.Event{{Type: db.EventScoreboardReset, ActorID: playerID, Actor: game.Players[playerID]}}
+}
+
+// decideVisibility lets the host list the game in the game browser or take it off.
+func decideVisibility(game *db.Game, playerID string, public bool) []db.Event {
+	if !playerIsHostInLobby(game, playerID) || game.Public == public {
+		return nil
+	}
+	setting := VisibilityPrivate
+	if public {
+		setting = VisibilityPublic
+	}
+	return []db.Event{{Type: db.EventVisibility, ActorID: playerID, Actor: game.Players[playerID], Setting: setting}}
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"sort"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// PlayerScore how a player has done in the rounds played in this game
+type PlayerScore struct {
+	Name          string
+	Wins          int
+	Losses        int
+	SpyWins       int
+	SpyLosses     int
+	GuesserWins   int
+	GuesserLosses int
+	AssassinHits  int
+}
+
+// Scoreboard running tally of the rounds played in this game
+type Scoreboard struct {
+	RedWins                 int
+	BlueWins                int
+	RedAverageCardsPerTurn  float64
+	BlueAverageCardsPerTurn float64
+	Players                 []PlayerScore
+}
+
+func newScoreboard() db.Scoreboard {
+	return db.Scoreboard{Players: map[string]db.PlayerScore{}}
+}
+
+func copyScoreboard(scoreboard db.Scoreboard) db.Scoreboard {
+	copied := scoreboard
+	copied.Players = make(map[string]db.PlayerScore, len(scoreboard.Players))
+	for playerID, score := range scoreboard.Players {
+		copied.Players[playerID] = score
+	}
+	return copied
+}
+
+// endTurn counts a finished turn of the given team.
+func endTurn(scoreboard *db.Scoreboard, team string) {
+	if team == "red" {
+		scoreboard.RedTurns++
+	} else {
+		scoreboard.BlueTurns++
+	}
+}
+
+// scoreGuess counts the cards a team found and the turns that ended because of a wrong guess.
+func scoreGuess(game *db.Game, event db.Event) {
+	if event.Correct {
+		if event.Team == "red" {
+			game.Scoreboard.RedCardsGuessed++
+		} else {
+			game.Scoreboard.BlueCardsGuessed++
+		}
+		return
+	}
+	endTurn(&game.Scoreboard, event.Team)
+	if event.BelongsTo == "black" {
+		score := game.Scoreboard.Players[event.ActorID]
+		score.Name = event.Actor
+		score.AssassinHits++
+		game.Scoreboard.Players[event.ActorID] = score
+	}
+}
+
+// scoreWin credits the winning team and its players, and debits the losers.
+func scoreWin(game *db.Game, winner string) {
+	if game.LastCardGuessedCorrectly {
+		// The winning guess didn't end the turn on its own.
+		endTurn(&game.Scoreboard, game.WhoseTurn)
+	}
+	if winner == "red" {
+		game.Scoreboard.RedWins++
+	} else {
+		game.Scoreboard.BlueWins++
+	}
+	record := func(team map[string]string, spy string, won bool) {
+		for playerID, playerName := range team {
+			score := game.Scoreboard.Players[playerID]
+			score.Name = playerName
+			isSpy := playerName == spy
+			switch {
+			case won && isSpy:
+				score.Wins++
+				score.SpyWins++
+			case won:
+				score.Wins++
+				score.GuesserWins++
+			case isSpy:
+				score.Losses++
+				score.SpyLosses++
+			default:
+				score.Losses++
+				score.GuesserLosses++
+			}
+			game.Scoreboard.Players[playerID] = score
+		}
+	}
+	record(game.TeamRed, game.TeamRedSpy, winner == "red")
+	record(game.TeamBlue, game.TeamBlueSpy, winner == "blue")
+}
+
+func averageCardsPerTurn(cards int, turns int) float64 {
+	if turns == 0 {
+		return 0
+	}
+	return float64(cards) / float64(turns)
+}
+
+// mapScoreboard turns the stored scoreboard into the one shown to participants, best players first.
+func mapScoreboard(scoreboard db.Scoreboard) Scoreboard {
+	mapped := Scoreboard{
+		RedWins:                 scoreboard.RedWins,
+		BlueWins:                scoreboard.BlueWins,
+		RedAverageCardsPerTurn:  averageCardsPerTurn(scoreboard.RedCardsGuessed, scoreboard.RedTurns),
+		BlueAverageCardsPerTurn: averageCardsPerTurn(scoreboard.BlueCardsGuessed, scoreboard.BlueTurns),
+		Players:                 make([]PlayerScore, 0, len(scoreboard.Players)),
+	}
+	for _, score := range scoreboard.Players {
+		mapped.Players = append(mapped.Players, PlayerScore(score))
+	}
+	sort.Slice(mapped.Players, func(i, j int) bool {
+		if mapped.Players[i].Wins != mapped.Players[j].Wins {
+			return mapped.Players[i].Wins > mapped.Players[j].Wins
+		}
+		return mapped.Players[i].Name < mapped.Players[j].Name
+	})
+	return mapped
+}
@@ -0,0 +1,181 @@
+package game
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// CareerStats how a player has done across every game they finished
+type CareerStats struct {
+	Name            string
+	GamesPlayed     int
+	Wins            int
+	WinRate         float64
+	SpyGames        int
+	SpyWinRate      float64
+	GuesserGames    int
+	GuesserWinRate  float64
+	AverageClueSize float64
+	GuessAccuracy   float64
+	AssassinRate    float64
+}
+
+func rate(count int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
+
+// MapCareerStats turns a player's stored totals into the rates shown to players.
+func MapCareerStats(stats db.PlayerStats) CareerStats {
+	return CareerStats{
+		Name:            stats.Name,
+		GamesPlayed:     stats.GamesPlayed,
+		Wins:            stats.Wins,
+		WinRate:         rate(stats.Wins, stats.GamesPlayed),
+		SpyGames:        stats.SpyGames,
+		SpyWinRate:      rate(stats.SpyWins, stats.SpyGames),
+		GuesserGames:    stats.GuesserGames,
+		GuesserWinRate:  rate(stats.GuesserWins, stats.GuesserGames),
+		AverageClueSize: rate(stats.ClueWords, stats.CluesGiven),
+		GuessAccuracy:   rate(stats.CorrectGuesses, stats.Guesses),
+		AssassinRate:    rate(stats.AssassinHits, stats.GamesPlayed),
+	}
+}
+
+// Leaderboard ranks the players of a game by wins, then by win rate. Player IDs are left out.
+func Leaderboard(game *db.Game, stats map[string]db.PlayerStats) []CareerStats {
+	leaderboard := make([]CareerStats, 0, len(game.Players))
+	for playerID, playerName := range game.Players {
+		career := MapCareerStats(stats[playerID])
+		career.Name = playerName
+		leaderboard = append(leaderboard, career)
+	}
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Wins != leaderboard[j].Wins {
+			return leaderboard[i].Wins > leaderboard[j].Wins
+		}
+		if leaderboard[i].WinRate != leaderboard[j].WinRate {
+			return leaderboard[i].WinRate > leaderboard[j].WinRate
+		}
+		return leaderboard[i].Name < leaderboard[j].Name
+	})
+	return leaderboard
+}
+
+// roundStats returns what each player did in the round the game just finished.
+func roundStats(game *db.Game) map[string]db.PlayerStats {
+	rounds := finishedRounds(game)
+	if len(rounds) == 0 || !strings.HasSuffix(game.Status, "won") {
+		return nil
+	}
+	r := rounds[len(rounds)-1]
+	winner := game.Events[r.end].Team
+	// Moves that were undone during the round don't count.
+	moves := []db.Event{}
+	for _, event := range game.Events[r.start : r.end+1] {
+		if event.Type != db.EventUndo {
+			moves = append(moves, event)
+			continue
+		}
+		kept := moves[:0]
+		for _, move := range moves {
+			if move.Seq < event.Target {
+				kept = append(kept, move)
+			}
+		}
+		moves = kept
+	}
+	stats := map[string]db.PlayerStats{}
+	record := func(team map[string]string, teamName string, spy string) {
+		for playerID, playerName := range team {
+			s := db.PlayerStats{Name: playerName, GamesPlayed: 1}
+			won := 0
+			if teamName == winner {
+				won = 1
+			}
+			s.Wins = won
+			if playerName == spy {
+				s.SpyGames, s.SpyWins = 1, won
+			} else {
+				s.GuesserGames, s.GuesserWins = 1, won
+			}
+			stats[playerID] = s
+		}
+	}
+	record(game.TeamRed, "red", game.TeamRedSpy)
+	record(game.TeamBlue, "blue", game.TeamBlueSpy)
+	for _, move := range moves {
+		s, isPlayer := stats[move.ActorID]
+		if !isPlayer {
+			continue
+		}
+		switch move.Type {
+		case db.EventClue:
+			s.CluesGiven++
+			s.ClueWords += move.Count
+		case db.EventGuess:
+			s.Guesses++
+			if move.Correct {
+				s.CorrectGuesses++
+			}
+			if move.BelongsTo == "black" {
+				s.AssassinHits++
+			}
+		}
+		stats[move.ActorID] = s
+	}
+	return stats
+}
+
+// statsChange returns how committing events to game changes its players' career stats: a won round is
+// added and a win that is undone is taken back.
+func statsChange(game *db.Game, events []db.Event) (map[string]db.PlayerStats, int) {
+	for _, event := range events {
+		switch event.Type {
+		case db.EventWin:
+			next := game
+			for _, event := range events {
+				var err error
+				next, err = Reduce(next, event)
+				if err != nil {
+					return nil, 0
+				}
+				next.Events = append(next.Events, event)
+			}
+			return roundStats(next), 1
+		case db.EventUndo:
+			if strings.HasSuffix(game.Status, "won") {
+				return roundStats(game), -1
+			}
+		}
+	}
+	return nil, 0
+}
+
+// commitAndRecordStats commits the decided events and updates the career stats of the players when the
+// events finish a round or undo its end.
+func commitAndRecordStats(ctx context.Context, client *firestore.Client, gameID string, decide db.Decider) error {
+	var stats map[string]db.PlayerStats
+	sign := 0
+	err := commit(ctx, client, gameID, func(game *db.Game) ([]db.Event, error) {
+		events, err := decide(game)
+		if err == nil {
+			stats, sign = statsChange(game, events)
+		}
+		return events, err
+	})
+	if err != nil || sign == 0 {
+		return err
+	}
+	if err := db.AddPlayerStats(ctx, client, stats, sign); err != nil {
+		log.Println("Could not record player stats", gameID, err)
+	}
+	return nil
+}
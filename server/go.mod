@@ -6,6 +6,7 @@ require (
 	cloud.google.com/go/firestore v1.2.0
 	firebase.google.com/go v3.12.0+incompatible
 	github.com/gorilla/websocket v1.4.2
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 	google.golang.org/api v0.22.0
 	google.golang.org/grpc v1.28.0
 )
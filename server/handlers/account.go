@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/account"
+	"github.com/RobertDHanna/OpenCodenames/captcha"
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/ids"
+	"github.com/RobertDHanna/OpenCodenames/ratelimit"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, token string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     account.SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// baseURL returns the address players reach the server at, used in links sent by email.
+func baseURL(r *http.Request) string {
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		return publicURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+// playerIDForRequest returns the player ID of the logged in account making the request, or a new one.
+func playerIDForRequest(ctx context.Context, client *firestore.Client, r *http.Request) (string, error) {
+	if a, err := account.FromRequest(ctx, client, r); err == nil {
+		return a.PlayerID, nil
+	}
+	return ids.NewSecret()
+}
+
+// registerRequest the body of a request to create an account.
+type registerRequest struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Captcha  string `json:"captcha"`
+}
+
+// loginRequest the body of a request to log in with a password.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// magicLinkRequest the body of a request for a login link.
+type magicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// successResponse the body of a successful request that has nothing else to say.
+type successResponse struct {
+	Success bool `json:"success"`
+}
+
+// RegisterHandler creates an account with a username and password and logs the player in.
+func RegisterHandler(client *firestore.Client, verifier captcha.Verifier) utils.Handler {
+	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		var req registerRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := verifyBrowser(ctx, w, r, verifier, req.Captcha, captchaActionRegister); err != nil {
+			writeError(w, err)
+			return
+		}
+		token, a, err := account.Register(ctx, client, req.Username, req.Email, req.Password)
+		if err != nil {
+			log.Println("RegisterHandler: Could not create account", err)
+			writeError(w, err)
+			return
+		}
+		setSessionCookie(w, r, token, config.SessionTTL())
+		utils.WriteJSON(w, http.StatusCreated, account.ToProfile(a))
+	})
+}
+
+// LoginHandler logs a player in with their username and password.
+func LoginHandler(client *firestore.Client) utils.Handler {
+	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		var req loginRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		token, a, err := account.Login(ctx, client, req.Username, req.Password)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		setSessionCookie(w, r, token, config.SessionTTL())
+		utils.WriteJSON(w, http.StatusOK, account.ToProfile(a))
+	})
+}
+
+// LogoutHandler ends the session of the player making the request.
+func LogoutHandler(client *firestore.Client) utils.Handler {
+	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		if cookie, err := r.Cookie(account.SessionCookie); err == nil {
+			if err := account.Logout(ctx, client, cookie.Value); err != nil {
+				log.Println("LogoutHandler: Could not delete session", err)
+			}
+		}
+		setSessionCookie(w, r, "", 0)
+		utils.WriteJSON(w, http.StatusOK, successResponse{Success: true})
+	})
+}
+
+// MagicLinkHandler emails a login link to the given address, if it belongs to an account.
+func MagicLinkHandler(client *firestore.Client, mailer account.Mailer) utils.Handler {
+	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		var req magicLinkRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if !magicLinksByIP.Allow(utils.GetIP(r)) || !magicLinksByEmail.Allow(strings.ToLower(strings.TrimSpace(req.Email))) {
+			writeError(w, ratelimit.ErrLimited)
+			return
+		}
+		err := account.SendMagicLink(ctx, client, mailer, req.Email, baseURL(r))
+		if err != nil {
+			log.Println("MagicLinkHandler: Could not send link", err)
+			writeError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, successResponse{Success: true})
+	})
+}
+
+// VerifyMagicLinkHandler logs in the player who followed a magic link and sends them to the home page.
+func VerifyMagicLinkHandler(client *firestore.Client) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		token, _, err := account.FinishMagicLink(ctx, client, r.URL.Query().Get("token"))
+		if err != nil {
+			http.Error(w, "This login link is invalid or has expired", http.StatusUnauthorized)
+			return
+		}
+		setSessionCookie(w, r, token, config.SessionTTL())
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
+
+// ProfileHandler returns the account of the logged in player.
+func ProfileHandler(client *firestore.Client) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		a, err := account.FromRequest(ctx, client, r)
+		if err != nil {
+			writeError(w, account.ErrNotLoggedIn)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, account.ToProfile(a))
+	})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/RobertDHanna/OpenCodenames/account"
+	"github.com/RobertDHanna/OpenCodenames/captcha"
+	"github.com/RobertDHanna/OpenCodenames/db"
+	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/RobertDHanna/OpenCodenames/ids"
+	"github.com/RobertDHanna/OpenCodenames/ratelimit"
+	"github.com/RobertDHanna/OpenCodenames/token"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// maxBodyBytes is the largest request body the API will read.
+const maxBodyBytes = 64 << 10
+
+// Errors only the handlers return.
+var (
+	errInvalidBody   = errors.New("InvalidBody")
+	errMissingField  = errors.New("MissingField")
+	errInvalidRound  = errors.New("InvalidRound")
+	errNotAPlayer    = errors.New("NotAPlayer")
+	errPasswordInURL = errors.New("PasswordInURL")
+)
+
+// apiErrors maps every error a client can act on to its status code and a message for people.
+// Anything not listed is reported as a 500 without its details.
+var apiErrors = map[error]struct {
+	status  int
+	message string
+}{
+	errInvalidBody:                {http.StatusBadRequest, "The request body is not valid JSON"},
+	errMissingField:               {http.StatusBadRequest, "A required field is missing"},
+	errInvalidRound:               {http.StatusBadRequest, "The round must be a positive number"},
+	errPasswordInURL:              {http.StatusBadRequest, "Send the room password in an Authenticate message, not in the URL"},
+	captcha.ErrMissingToken:       {http.StatusBadRequest, "A captcha token is required"},
+	errInvalidAction:              {http.StatusBadRequest, "Unknown captcha action"},
+	g.ErrPasswordTooLong:          {http.StatusBadRequest, "The room password is too long"},
+	account.ErrInvalidUsername:    {http.StatusBadRequest, "Usernames are 3 to 24 letters, numbers, - or _"},
+	account.ErrInvalidEmail:       {http.StatusBadRequest, "The email address is not valid"},
+	account.ErrPasswordTooShort:   {http.StatusBadRequest, "Passwords need at least 8 characters"},
+	g.ErrPasswordRequired:         {http.StatusUnauthorized, "This game needs a password"},
+	account.ErrInvalidCredentials: {http.StatusUnauthorized, "The username or password is wrong"},
+	account.ErrInvalidLink:        {http.StatusUnauthorized, "This login link is invalid or has expired"},
+	account.ErrNotLoggedIn:        {http.StatusUnauthorized, "You are not logged in"},
+	token.ErrInvalidToken:         {http.StatusUnauthorized, "The player token is invalid"},
+	token.ErrTokenExpired:         {http.StatusUnauthorized, "The player token has expired"},
+	errNotAPlayer:                 {http.StatusForbidden, "You are not a player of this game"},
+	g.ErrWrongPassword:            {http.StatusForbidden, "The password is wrong"},
+	captcha.ErrFailed:             {http.StatusForbidden, "The captcha could not be verified"},
+	db.ErrGameDoesntExist:         {http.StatusNotFound, "This game doesn't exist"},
+	db.ErrAccountDoesntExist:      {http.StatusNotFound, "This account doesn't exist"},
+	g.ErrNoFinishedRounds:         {http.StatusNotFound, "No round of this game has finished yet"},
+	g.ErrHistoryIncomplete:        {http.StatusConflict, "This game is older than its history and can't be replayed"},
+	g.ErrRoundNotFinished:         {http.StatusNotFound, "This round hasn't finished yet"},
+	g.ErrNameAlreadyTaken:         {http.StatusConflict, "Someone in this game already has that name"},
+	g.ErrGameIsFull:               {http.StatusConflict, "This game is full"},
+	g.ErrGameAlreadyStarted:       {http.StatusConflict, "This game has already started"},
+	db.ErrUsernameAlreadyTaken:    {http.StatusConflict, "That username is taken"},
+	account.ErrEmailAlreadyUsed:   {http.StatusConflict, "That email address is already used by another account"},
+	errTooManyAttempts:            {http.StatusTooManyRequests, "Too many wrong passwords, try again later"},
+	ratelimit.ErrLimited:          {http.StatusTooManyRequests, "Too many requests, try again later"},
+	ids.ErrExhausted:              {http.StatusServiceUnavailable, "No game IDs are free right now, try again later"},
+}
+
+// writeError writes the error envelope for err.
+func writeError(w http.ResponseWriter, err error) {
+	known, ok := apiErrors[err]
+	if !ok {
+		log.Println("Unexpected API error", err)
+		utils.WriteError(w, http.StatusInternalServerError, "InternalError", "Something went wrong")
+		return
+	}
+	utils.WriteError(w, known.status, err.Error(), known.message)
+}
+
+// decodeBody reads the JSON body of a request into v.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v)
+	if err != nil && err != io.EOF {
+		log.Println("Could not decode request body", err)
+		return errInvalidBody
+	}
+	return nil
+}
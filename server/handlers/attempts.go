@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/db"
+	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// failures counts the wrong passwords sent from one IP since windowStart.
+type failures struct {
+	count       int
+	windowStart time.Time
+}
+
+// attemptLimiter refuses password checks from IPs that sent too many wrong passwords recently.
+type attemptLimiter struct {
+	mu   sync.Mutex
+	byIP map[string]failures
+}
+
+var errTooManyAttempts = errors.New("TooManyAttempts")
+
+var passwordAttempts = &attemptLimiter{byIP: map[string]failures{}}
+
+// allowed reports whether the IP may try another password.
+func (l *attemptLimiter) allowed(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.byIP[ip]
+	return !ok || time.Since(f.windowStart) > config.PasswordAttemptWindow() || f.count < config.PasswordAttempts()
+}
+
+// fail records a wrong password from the IP and forgets IPs whose window is over.
+func (l *attemptLimiter) fail(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for otherIP, f := range l.byIP {
+		if now.Sub(f.windowStart) > config.PasswordAttemptWindow() {
+			delete(l.byIP, otherIP)
+		}
+	}
+	f, ok := l.byIP[ip]
+	if !ok {
+		f = failures{windowStart: now}
+	}
+	f.count++
+	l.byIP[ip] = f
+}
+
+// checkRoomPassword checks the password sent for a game, refusing IPs that guessed wrong too often.
+func checkRoomPassword(r *http.Request, game *db.Game, password string, spectator bool) error {
+	ip := utils.GetIP(r)
+	if !passwordAttempts.allowed(ip) {
+		return errTooManyAttempts
+	}
+	err := g.CheckRoomPassword(game, password, spectator)
+	if err == g.ErrWrongPassword {
+		passwordAttempts.fail(ip)
+	}
+	return err
+}
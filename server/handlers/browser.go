@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/captcha"
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/db"
+	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/RobertDHanna/OpenCodenames/ids"
+	"github.com/RobertDHanna/OpenCodenames/token"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// openGamesListed is how many games the game browser shows and quick join picks from.
+const openGamesListed = 25
+
+// ListGamesHandler returns the public games that are waiting for players.
+func ListGamesHandler(client *firestore.Client) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		games, err := db.ListOpenGames(ctx, client, config.PlayerLimit(), openGamesListed)
+		if err != nil {
+			log.Println("ListGamesHandler: Could not list games", err)
+			writeError(w, err)
+			return
+		}
+		openGames := make([]g.OpenGame, 0, len(games))
+		for _, game := range games {
+			openGames = append(openGames, g.MapOpenGame(game, config.PlayerLimit()))
+		}
+		utils.WriteJSON(w, http.StatusOK, openGames)
+	})
+}
+
+// quickJoinRequest the body of a quick join request.
+type quickJoinRequest struct {
+	PlayerName string `json:"playerName"`
+	Captcha    string `json:"captcha"`
+}
+
+// QuickJoinHandler puts a player into the public game that best fits them, or creates a new public game
+// with them as its host when none does.
+func QuickJoinHandler(client *firestore.Client, gameIDs *ids.Allocator, verifier captcha.Verifier) utils.Handler {
+	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		var req quickJoinRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.PlayerName == "" {
+			writeError(w, errMissingField)
+			return
+		}
+		if err := verifyBrowser(ctx, w, r, verifier, req.Captcha, captchaActionQuickJoin); err != nil {
+			writeError(w, err)
+			return
+		}
+		playerName := req.PlayerName
+		playerID, err := playerIDForRequest(ctx, client, r)
+		if err != nil {
+			log.Println("Failure creating playerID", err)
+			writeError(w, err)
+			return
+		}
+		games, err := db.ListOpenGames(ctx, client, config.PlayerLimit(), openGamesListed)
+		if err != nil {
+			log.Println("QuickJoinHandler: Could not list games", err)
+		}
+		gameID := ""
+		for _, game := range g.QuickJoinCandidates(games, playerName) {
+			// Another player may have filled the game or taken the name since it was listed.
+			if err := g.AddPlayerToGame(ctx, client, game.ID, playerID, playerName); err == nil {
+				gameID = game.ID
+				break
+			}
+		}
+		if gameID == "" {
+			game, err := createGame(ctx, client, gameIDs, []db.Event{
+				{Type: db.EventJoin, ActorID: playerID, Actor: playerName, Role: "bluespy"},
+				{Type: db.EventVisibility, ActorID: playerID, Actor: playerName, Setting: g.VisibilityPublic},
+			})
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			gameID = game.ID
+		}
+		playerToken, err := token.Issue(gameID, playerID)
+		if err != nil {
+			log.Println("Could not issue a player token", err)
+			writeError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, joinGameResponse{Success: true, ID: gameID, PlayerID: playerID, Token: playerToken})
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/RobertDHanna/OpenCodenames/captcha"
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/token"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// Actions browsers name when they get a captcha token, so a token can't be reused for another endpoint.
+const (
+	captchaActionCreateGame = "create_game"
+	captchaActionQuickJoin  = "quick_join"
+	captchaActionJoinGame   = "join_game"
+	captchaActionSpectate   = "spectate"
+	captchaActionRegister   = "register"
+)
+
+// trustCookie holds a token proving the browser passed a captcha recently.
+const trustCookie = "trusted"
+
+var errInvalidAction = errors.New("InvalidAction")
+
+// captchaConfig what a browser needs to get captcha tokens
+type captchaConfig struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"siteKey"`
+}
+
+// CaptchaConfigHandler tells browsers which bot protection provider to get their tokens from.
+func CaptchaConfigHandler() utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		utils.WriteJSON(w, http.StatusOK, captchaConfig{Provider: config.CaptchaProvider(), SiteKey: config.CaptchaSiteKey()})
+	})
+}
+
+// trusted reports whether the request comes from a browser that passed a captcha recently. The cookie only counts
+// from the IP and user agent it was issued to.
+func trusted(r *http.Request) bool {
+	cookie, err := r.Cookie(trustCookie)
+	return err == nil && token.VerifyTrust(cookie.Value, utils.GetIP(r), r.UserAgent()) == nil
+}
+
+// verifyCaptcha checks the bot protection token sent along with a request.
+func verifyCaptcha(ctx context.Context, verifier captcha.Verifier, r *http.Request, captchaToken string, action string) error {
+	err := verifier.Verify(ctx, captchaToken, utils.GetIP(r), action)
+	if err != nil {
+		log.Println("Captcha check failed", err)
+	}
+	return err
+}
+
+// verifyBrowser lets trusted browsers through and checks the captcha token of everyone else, trusting their
+// browser from then on.
+func verifyBrowser(ctx context.Context, w http.ResponseWriter, r *http.Request, verifier captcha.Verifier, captchaToken string, action string) error {
+	if trusted(r) {
+		return nil
+	}
+	if err := verifyCaptcha(ctx, verifier, r, captchaToken, action); err != nil {
+		return err
+	}
+	trustToken, err := token.IssueTrust(utils.GetIP(r), r.UserAgent())
+	if err != nil {
+		log.Println("Could not issue a trust token", err)
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     trustCookie,
+		Value:    trustToken,
+		Path:     "/",
+		MaxAge:   int(config.TrustTTL().Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// verifySpectator lets trusted browsers watch a game and checks the captcha param of everyone else, so the
+// spectator view can't be scraped without passing one.
+func verifySpectator(ctx context.Context, verifier captcha.Verifier, r *http.Request) error {
+	if trusted(r) {
+		return nil
+	}
+	return verifyCaptcha(ctx, verifier, r, r.FormValue("captcha"), captchaActionSpectate)
+}
+
+// captchaVerifyRequest the body of a request to have a browser trusted before it opens a WebSocket.
+type captchaVerifyRequest struct {
+	Captcha string `json:"captcha"`
+	Action  string `json:"action"`
+}
+
+// CaptchaVerifyHandler checks a captcha token and sets the trust cookie, for the spectator endpoints, which don't
+// set it themselves.
+func CaptchaVerifyHandler(verifier captcha.Verifier) utils.Handler {
+	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
+		var req captchaVerifyRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.Action != captchaActionSpectate {
+			writeError(w, errInvalidAction)
+			return
+		}
+		if err := verifyBrowser(context.Background(), w, r, verifier, req.Captcha, req.Action); err != nil {
+			writeError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, successResponse{Success: true})
+	})
+}
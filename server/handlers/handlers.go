@@ -6,139 +6,435 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"cloud.google.com/go/firestore"
-	"github.com/RobertDHanna/OpenCodenames/data"
+	"github.com/RobertDHanna/OpenCodenames/captcha"
 	"github.com/RobertDHanna/OpenCodenames/db"
+	g "github.com/RobertDHanna/OpenCodenames/game"
 	h "github.com/RobertDHanna/OpenCodenames/hub"
-	"github.com/RobertDHanna/OpenCodenames/recaptcha"
+	"github.com/RobertDHanna/OpenCodenames/ids"
+	"github.com/RobertDHanna/OpenCodenames/ratelimit"
+	"github.com/RobertDHanna/OpenCodenames/token"
 	"github.com/RobertDHanna/OpenCodenames/utils"
 	"github.com/gorilla/websocket"
 )
 
-// CreateGameHandler TODO: document
-func CreateGameHandler(client *firestore.Client) utils.Handler {
+// createGameRequest the body of a request to create a game. Without a playerName the creator only spectates.
+type createGameRequest struct {
+	PlayerName        string `json:"playerName"`
+	Password          string `json:"password"`
+	ProtectSpectators bool   `json:"protectSpectators"`
+	Public            bool   `json:"public"`
+	Captcha           string `json:"captcha"`
+}
+
+// createGameResponse the body of a successful request to create a game.
+type createGameResponse struct {
+	ID       string `json:"id"`
+	PlayerID string `json:"playerID"`
+	Token    string `json:"token"`
+}
+
+// CreateGameHandler creates a game, adding the player who asked for it as its blue spymaster.
+func CreateGameHandler(client *firestore.Client, gameIDs *ids.Allocator, verifier captcha.Verifier) utils.Handler {
 	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
-		paramMap, err := url.ParseQuery(r.URL.RawQuery)
-		if err != nil {
-			log.Println("Could not parse URL", err)
+		var req createGameRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
 			return
 		}
-		playerName, playerNameErr := utils.GetQueryValue(&paramMap, "playerName")
-		recaptchaResponse, recaptchaErr := utils.GetQueryValue(&paramMap, "recaptcha")
-		if recaptchaResponse == "" || recaptchaErr != nil {
-			log.Println("A ReCAPTCHA token is required")
+		if err := verifyBrowser(ctx, w, r, verifier, req.Captcha, captchaActionCreateGame); err != nil {
+			writeError(w, err)
 			return
 		}
-		recaptcha.Init(data.GetReCAPTCHAKey())
-		response, err := recaptcha.Check(utils.GetIP(r), recaptchaResponse)
-		log.Println("ReCAPTCHA response: ", response)
-		if response.Score < 0.1 || err != nil {
-			log.Println("ReCAPTCHA request failed", err)
-			return
-		}
-		playerMap := make(map[string]string)
-		teamRed := make(map[string]string)
-		teamBlue := make(map[string]string)
-		creatorID := ""
-		teamBlueSpy := ""
-		playerID, err := utils.MakeEasyID(15)
+		events := []db.Event{}
+		playerID, err := playerIDForRequest(ctx, client, r)
 		if err != nil {
 			log.Println("Failure creating playerID", err)
+			writeError(w, err)
+			return
 		}
-		if len(playerName) > 0 && playerNameErr == nil {
-			playerMap[playerID] = playerName
-			teamBlue[playerID] = playerName
-			creatorID = playerID
-			teamBlueSpy = playerName
-		}
-		game := db.Game{
-			ID:                       "",
-			Status:                   "pending",
-			Players:                  playerMap,
-			CreatorID:                creatorID,
-			TeamRed:                  teamRed,
-			TeamBlue:                 teamBlue,
-			TeamRedSpy:               "",
-			TeamBlueSpy:              teamBlueSpy,
-			TeamRedGuesser:           "",
-			TeamBlueGuesser:          "",
-			WhoseTurn:                "",
-			Cards:                    make(map[string]db.Card),
-			LastCardGuessed:          "",
-			LastCardGuessedBy:        "",
-			LastCardGuessedCorrectly: false,
-			TimesPlayed:              0,
-		}
-		id := ""
-		for {
-			id, err = utils.MakeEasyID(5)
+		if len(req.PlayerName) > 0 {
+			events = append(events, db.Event{Type: db.EventJoin, ActorID: playerID, Actor: req.PlayerName, Role: "bluespy"})
+		}
+		if req.Password != "" {
+			passwordEvent, err := g.RoomPasswordEvent(req.Password, req.ProtectSpectators)
 			if err != nil {
-				log.Println("Could not make an ID", err)
+				writeError(w, err)
 				return
 			}
-			game.ID = id
-			err = db.CreateGame(ctx, client, &game)
+			passwordEvent.ActorID = playerID
+			passwordEvent.Actor = req.PlayerName
+			events = append(events, passwordEvent)
+		}
+		if req.Public {
+			events = append(events, db.Event{Type: db.EventVisibility, ActorID: playerID, Actor: req.PlayerName, Setting: g.VisibilityPublic})
+		}
+		game, err := createGame(ctx, client, gameIDs, events)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		playerToken := ""
+		if len(game.Players) > 0 {
+			playerToken, err = token.Issue(game.ID, playerID)
 			if err != nil {
-				if err.Error() == "GameAlreadyExists" {
-					log.Println("GameAlreadyExists!", id)
-					continue
-				}
-				fmt.Fprintf(w, "failed to create game %s %s!", r.Method, id)
+				log.Println("Could not issue a player token", err)
+				writeError(w, err)
 				return
 			}
-			break
 		}
-		fmt.Fprintf(w, `{"id":"%s","playerID":"%s"}`, id, playerID)
+		utils.WriteJSON(w, http.StatusCreated, createGameResponse{ID: game.ID, PlayerID: playerID, Token: playerToken})
+	})
+}
+
+// createGame builds a game from its first events and stores it under a new, unused ID. The hub only knows the games
+// being played, so IDs of idle stored games can come up; db.CreateGame refuses them and another ID is tried.
+func createGame(ctx context.Context, client *firestore.Client, gameIDs *ids.Allocator, events []db.Event) (*db.Game, error) {
+	game, err := g.Create("", events)
+	if err != nil {
+		log.Println("Could not build new game", err)
+		return nil, err
+	}
+	_, err = gameIDs.Allocate(func(id string) error {
+		game.ID = id
+		game.Checkpoint.ID = id
+		err := db.CreateGame(ctx, client, game)
+		if err == db.ErrGameAlreadyExists {
+			log.Println("GameAlreadyExists!", id)
+			return ids.ErrTaken
+		}
+		return err
 	})
+	if err != nil {
+		log.Println("Could not create game", err)
+		return nil, err
+	}
+	return game, nil
+}
+
+// joinGameRequest the body of a request to join a game.
+type joinGameRequest struct {
+	GameID     string `json:"gameID"`
+	PlayerName string `json:"playerName"`
+	Password   string `json:"password"`
+	Captcha    string `json:"captcha"`
+	// PlayerID is only sent by players of games from before tokens existed, see ids.LegacyPlayerID.
+	PlayerID string `json:"playerID,omitempty"`
+}
+
+// joinGameResponse the body of a successful request to join a game.
+type joinGameResponse struct {
+	Success  bool   `json:"success"`
+	ID       string `json:"id,omitempty"`
+	PlayerID string `json:"playerID"`
+	Token    string `json:"token"`
 }
 
 // JoinGameHandler Handles adding a player to game
-func JoinGameHandler(client *firestore.Client) utils.Handler {
+func JoinGameHandler(client *firestore.Client, verifier captcha.Verifier) utils.Handler {
 	return utils.PostRequest(func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
-		paramMap, err := url.ParseQuery(r.URL.RawQuery)
+		var req joinGameRequest
+		if err := decodeBody(w, r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.GameID == "" || (req.PlayerName == "" && req.PlayerID == "") {
+			writeError(w, errMissingField)
+			return
+		}
+		if !joinAttempts.Allow(joinKey(req.GameID, utils.GetIP(r))) {
+			writeError(w, ratelimit.ErrLimited)
+			return
+		}
+		if err := verifyBrowser(ctx, w, r, verifier, req.Captcha, captchaActionJoinGame); err != nil {
+			writeError(w, err)
+			return
+		}
+		if req.PlayerID != "" {
+			claimLegacyPlayer(ctx, client, w, req.GameID, req.PlayerID)
+			return
+		}
+		playerID, err := playerIDForRequest(ctx, client, r)
 		if err != nil {
-			log.Println("Could not parse URL", err)
+			log.Println("Failure creating playerID", err)
+			writeError(w, err)
+			return
+		}
+		game, err := db.GetGame(ctx, client, req.GameID)
+		if err != nil {
+			writeError(w, err)
 			return
 		}
+		if _, alreadyAdded := game.Players[playerID]; !alreadyAdded {
+			if err := checkRoomPassword(r, game, req.Password, false); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+		err = g.AddPlayerToGame(ctx, client, req.GameID, playerID, req.PlayerName)
+		if err != nil && err != g.ErrPlayerAlreadyAdded {
+			log.Printf("Failed to add player %s to %s!", req.PlayerName, req.GameID)
+			writeError(w, err)
+			return
+		}
+		writeJoinResponse(w, req.GameID, playerID)
+	})
+}
+
+// writeJoinResponse issues a token for a player who joined a game and sends it to them.
+func writeJoinResponse(w http.ResponseWriter, gameID string, playerID string) {
+	playerToken, err := token.Issue(gameID, playerID)
+	if err != nil {
+		log.Println("Could not issue a player token", err)
+		writeError(w, err)
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, joinGameResponse{Success: true, PlayerID: playerID, Token: playerToken})
+}
+
+// claimLegacyPlayer gives a token to a player of a game from before tokens existed. Their player ID was all they
+// needed to play then, so it still proves who they are, but only IDs of that era are accepted: new ones are
+// never sent by clients.
+func claimLegacyPlayer(ctx context.Context, client *firestore.Client, w http.ResponseWriter, gameID string, playerID string) {
+	game, err := db.GetGame(ctx, client, gameID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if _, isPlayer := game.Players[playerID]; !isPlayer || !ids.LegacyPlayerID(playerID) {
+		writeError(w, errNotAPlayer)
+		return
+	}
+	writeJoinResponse(w, gameID, playerID)
+}
+
+// bearerToken returns the token sent in the Authorization header of a request, if any.
+func bearerToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+}
+
+// playerFromToken returns the player of game the token in the Authorization header was issued to.
+func playerFromToken(r *http.Request, game *db.Game) (string, error) {
+	claims, err := token.Verify(bearerToken(r))
+	if err == nil && claims.GameID != game.ID {
+		err = token.ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, isPlayer := game.Players[claims.PlayerID]; !isPlayer {
+		return "", errNotAPlayer
+	}
+	return claims.PlayerID, nil
+}
+
+// checkSpectator lets a request see what spectators of game see: the browser has to be trusted or send a captcha,
+// and the room password when spectators are asked for it.
+func checkSpectator(ctx context.Context, verifier captcha.Verifier, r *http.Request, game *db.Game) error {
+	if err := verifySpectator(ctx, verifier, r); err != nil {
+		return err
+	}
+	return checkRoomPassword(r, game, r.URL.Query().Get("password"), true)
+}
+
+// GameStateHandler returns the game at /game/{id}. Players that send their token in the Authorization header get
+// their own view of it, everyone else gets what spectators see once they pass the same checks as spectating.
+func GameStateHandler(client *firestore.Client, verifier captcha.Verifier) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		gameID := strings.TrimPrefix(r.URL.Path, "/game/")
+		if gameID == "" || strings.Contains(gameID, "/") {
+			writeError(w, db.ErrGameDoesntExist)
+			return
+		}
+		game, err := db.GetGame(ctx, client, gameID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if bearerToken(r) != "" {
+			playerID, err := playerFromToken(r, game)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			view, err := g.MapGameForPlayer(game, playerID)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			utils.WriteJSON(w, http.StatusOK, view)
+			return
+		}
+		if err := checkSpectator(ctx, verifier, r, game); err != nil {
+			writeError(w, err)
+			return
+		}
+		view, err := g.MapGameToBaseGame(game)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, view)
+	})
+}
+
+// getRound reads the optional round param, 0 meaning the latest finished round.
+func getRound(paramMap *url.Values) (int, error) {
+	roundParam, err := utils.GetQueryValue(paramMap, "round")
+	if err != nil {
+		return 0, nil
+	}
+	round, err := strconv.Atoi(roundParam)
+	if err != nil || round < 0 {
+		return 0, errInvalidRound
+	}
+	return round, nil
+}
+
+// ExportGameHandler returns a finished round of a game as a JSON document, behind the same checks as spectating.
+func ExportGameHandler(client *firestore.Client, verifier captcha.Verifier) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		paramMap := r.URL.Query()
 		gameID, err := utils.GetQueryValue(&paramMap, "gameID")
 		if err != nil {
-			fmt.Fprintf(w, "Invalid gameID")
+			writeError(w, errMissingField)
 			return
 		}
-		playerName, err := utils.GetQueryValue(&paramMap, "playerName")
+		round, err := getRound(&paramMap)
 		if err != nil {
-			fmt.Fprintf(w, "Invalid playerName")
+			writeError(w, err)
 			return
 		}
-		playerID, err := utils.MakeEasyID(15)
+		game, err := db.GetGame(ctx, client, gameID)
 		if err != nil {
-			log.Println("Failure creating playerID", err)
+			log.Println("ExportGameHandler: Could not find game", err)
+			writeError(w, err)
+			return
+		}
+		if err := checkSpectator(ctx, verifier, r, game); err != nil {
+			writeError(w, err)
+			return
+		}
+		export, err := g.ExportRound(game, round)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="codenames-%s-%d.json"`, export.GameID, export.Round))
+		utils.WriteJSON(w, http.StatusOK, export)
+	})
+}
+
+// ReplayHandler streams a finished round of a game to a spectator move by move, behind the same checks as spectating.
+func ReplayHandler(client *firestore.Client, verifier captcha.Verifier) utils.Handler {
+	return utils.WebSocketRequest(func(r *http.Request, c *websocket.Conn) {
+		ctx := context.Background()
+		paramMap, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			log.Println("ReplayHandler: Could not parse URL", err)
+			return
 		}
-		err = db.AddPlayerToGame(ctx, client, gameID, playerID, playerName)
+		if _, inURL := paramMap["password"]; inURL {
+			c.WriteJSON(map[string]string{"error": errPasswordInURL.Error()})
+			c.Close()
+			return
+		}
+		gameID, err := utils.GetQueryValue(&paramMap, "gameID")
+		if err != nil {
+			c.WriteJSON(map[string]string{"error": "missing gameID field"})
+			c.Close()
+			return
+		}
+		round, err := getRound(&paramMap)
 		if err != nil {
-			if err.Error() == "PlayerAlreadyAdded" {
-				fmt.Fprintf(w, `{"success":true,"playerID":"%s"}`, playerID)
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		speed := 1.0
+		if speedParam, err := utils.GetQueryValue(&paramMap, "speed"); err == nil {
+			speed, err = h.ParseReplaySpeed(speedParam)
+			if err != nil {
+				c.WriteJSON(map[string]string{"error": "invalid speed field"})
+				c.Close()
 				return
 			}
-			log.Printf("Failed to add player %s to %s!", playerName, gameID)
-			fmt.Fprintf(w, `{"error":"%s"}`, err)
+		}
+		if err := verifySpectator(ctx, verifier, r); err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
 			return
 		}
-		fmt.Fprintf(w, `{"success":true,"playerID":"%s"}`, playerID)
+		game, err := db.GetGame(ctx, client, gameID)
+		if err != nil {
+			c.WriteJSON(map[string]string{"error": "could not find game"})
+			c.Close()
+			return
+		}
+		password, err := readSpectatorPassword(c, game)
+		if err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		if err := checkRoomPassword(r, game, password, true); err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		frames, err := g.ReplayFrames(game, round)
+		if err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		replay := h.NewReplayClient(c, frames)
+		go replay.ReadPump()
+		go replay.WritePump(speed)
 	})
 }
 
+// readSpectatorPassword returns the room password a spectator sent in its first message, when game asks spectators for
+// it. Other games don't wait for one.
+func readSpectatorPassword(c *websocket.Conn, game *db.Game) (string, error) {
+	if game.PasswordHash == "" || !game.SpectatorsNeedPassword {
+		return "", nil
+	}
+	password, err := h.ReadPassword(c)
+	if err != nil {
+		return "", g.ErrPasswordRequired
+	}
+	return password, nil
+}
+
+// wantsDeltaUpdates reports whether a WebSocket client asked for patches instead of full games.
+func wantsDeltaUpdates(paramMap *url.Values) bool {
+	delta, err := utils.GetQueryValue(paramMap, "delta")
+	return err == nil && (delta == "1" || delta == "true")
+}
+
 // SpectatorHandler subscribes a "player" to a game without them having to be a player.
-func SpectatorHandler(client *firestore.Client, hub *h.Hub) utils.Handler {
+// Browsers have to be trusted already, see CaptchaVerifyHandler, while other clients can send a captcha token.
+func SpectatorHandler(client *firestore.Client, hub *h.Hub, verifier captcha.Verifier) utils.Handler {
 	return utils.WebSocketRequest(func(r *http.Request, c *websocket.Conn) {
 		paramMap, err := url.ParseQuery(r.URL.RawQuery)
 		if err != nil {
 			log.Println("SpectatorHandler: Could not parse URL", err)
 			return
 		}
+		if _, inURL := paramMap["password"]; inURL {
+			c.WriteJSON(map[string]string{"error": errPasswordInURL.Error()})
+			c.Close()
+			return
+		}
 		gameID, err := utils.GetQueryValue(&paramMap, "gameID")
 		if err != nil {
 			c.WriteJSON(map[string]string{"error": "missing gameID field"})
@@ -151,13 +447,36 @@ func SpectatorHandler(client *firestore.Client, hub *h.Hub) utils.Handler {
 			c.Close()
 			return
 		}
-		id, err := utils.MakeEasyID(15)
+		if err := verifySpectator(context.Background(), verifier, r); err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		game, err := db.GetGame(context.Background(), client, gameID)
+		if err != nil {
+			c.WriteJSON(map[string]string{"error": "could not find game"})
+			c.Close()
+			return
+		}
+		password, err := readSpectatorPassword(c, game)
+		if err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		if err := checkRoomPassword(r, game, password, true); err != nil {
+			c.WriteJSON(map[string]string{"error": err.Error()})
+			c.Close()
+			return
+		}
+		id, err := ids.NewSecret()
 		if err != nil {
 			c.WriteJSON(map[string]string{"error": "could not generate temporary id"})
 			c.Close()
 			return
 		}
 		client := h.NewClient(gameID, id, sessionID, hub, c, true)
+		client.Delta = wantsDeltaUpdates(&paramMap)
 		hub.Register <- client
 		go client.ReadPump()
 		go client.WritePump()
@@ -178,20 +497,31 @@ func PlayerHandler(client *firestore.Client, hub *h.Hub) utils.Handler {
 			c.Close()
 			return
 		}
-		playerID, err := utils.GetQueryValue(&paramMap, "playerID")
+		sessionID, err := utils.GetQueryValue(&paramMap, "sessionID")
 		if err != nil {
-			c.WriteJSON(map[string]string{"error": "missing playerID field"})
+			c.WriteJSON(map[string]string{"error": "missing sessionID field"})
 			c.Close()
 			return
 		}
-		sessionID, err := utils.GetQueryValue(&paramMap, "sessionID")
+		playerToken := bearerToken(r)
+		if playerToken == "" {
+			playerToken, err = h.ReadToken(c)
+			if err != nil {
+				c.WriteJSON(map[string]string{"error": "missing token"})
+				c.Close()
+				return
+			}
+		}
+		claims, err := token.Verify(playerToken)
 		if err != nil {
-			c.WriteJSON(map[string]string{"error": "missing sessionID field"})
+			c.WriteJSON(map[string]string{"error": "access denied"})
 			c.Close()
 			return
 		}
-		log.Printf("Success: gameID %s playerID %s sessionID %s", gameID, playerID, sessionID)
-		client := h.NewClient(gameID, playerID, sessionID, hub, c, false)
+		log.Printf("Success: gameID %s playerID %s sessionID %s", gameID, claims.PlayerID, sessionID)
+		client := h.NewClient(gameID, claims.PlayerID, sessionID, hub, c, false)
+		client.Delta = wantsDeltaUpdates(&paramMap)
+		client.Token = playerToken
 		hub.Register <- client
 		go client.ReadPump()
 		go client.WritePump()
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/ratelimit"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+var (
+	// gameCreations limits how many games each IP creates.
+	gameCreations = ratelimit.New(config.GamesPerIP(), config.GamesPerIPWindow())
+	// joinAttempts limits how often each IP tries to join a game, keyed by joinKey. Keying it by the game alone
+	// would let anyone lock everybody else out of a game.
+	joinAttempts = ratelimit.New(config.JoinsPerGame(), config.JoinsPerGameWindow())
+	// logins and registrations limit how often each IP tries a password and creates accounts.
+	logins        = ratelimit.New(config.LoginsPerIP(), config.LoginWindow())
+	registrations = ratelimit.New(config.RegistrationsPerIP(), config.RegistrationWindow())
+	// magicLinksByIP and magicLinksByEmail limit how many login links are asked for and mailed.
+	magicLinksByIP    = ratelimit.New(config.MagicLinksPerIP(), config.MagicLinkWindow())
+	magicLinksByEmail = ratelimit.New(config.MagicLinksPerEmail(), config.MagicLinkWindow())
+)
+
+// joinKey returns the key of an IP's join attempts for a game in joinAttempts.
+func joinKey(gameID string, ip string) string {
+	return gameID + " " + ip
+}
+
+// LimitLogins refuses IPs that tried to log in too often recently with 429 TooManyRequests.
+func LimitLogins(next utils.Handler) utils.Handler {
+	return logins.Middleware(utils.GetIP, next)
+}
+
+// LimitRegistrations refuses IPs that created too many accounts recently with 429 TooManyRequests.
+func LimitRegistrations(next utils.Handler) utils.Handler {
+	return registrations.Middleware(utils.GetIP, next)
+}
+
+// LimitGameCreation refuses IPs that created too many games recently with 429 TooManyRequests.
+func LimitGameCreation(next utils.Handler) utils.Handler {
+	return gameCreations.Middleware(utils.GetIP, next)
+}
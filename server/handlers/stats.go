@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/account"
+	"github.com/RobertDHanna/OpenCodenames/captcha"
+	"github.com/RobertDHanna/OpenCodenames/db"
+	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/RobertDHanna/OpenCodenames/token"
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// PlayerStatsHandler returns the career stats of the player whose token is in the Authorization header, or of the
+// logged in player. Player IDs are secret, so they are never taken from the URL.
+func PlayerStatsHandler(client *firestore.Client) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		var playerID string
+		if playerToken := bearerToken(r); playerToken != "" {
+			claims, err := token.Verify(playerToken)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			playerID = claims.PlayerID
+		} else {
+			a, err := account.FromRequest(ctx, client, r)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			playerID = a.PlayerID
+		}
+		stats, err := db.GetPlayerStats(ctx, client, []string{playerID})
+		if err != nil {
+			log.Println("PlayerStatsHandler: Could not get stats", err)
+			writeError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, g.MapCareerStats(stats[playerID]))
+	})
+}
+
+// LeaderboardHandler ranks the players of a game by their career stats. It names the players, so it is shown to
+// the game's players and to whoever may spectate it.
+func LeaderboardHandler(client *firestore.Client, verifier captcha.Verifier) utils.Handler {
+	return utils.GetRequest(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.Background()
+		paramMap := r.URL.Query()
+		gameID, err := utils.GetQueryValue(&paramMap, "gameID")
+		if err != nil {
+			writeError(w, errMissingField)
+			return
+		}
+		game, err := db.GetGame(ctx, client, gameID)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if bearerToken(r) != "" {
+			_, err = playerFromToken(r, game)
+		} else {
+			err = checkSpectator(ctx, verifier, r, game)
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		playerIDs := make([]string, 0, len(game.Players))
+		for playerID := range game.Players {
+			playerIDs = append(playerIDs, playerID)
+		}
+		stats, err := db.GetPlayerStats(ctx, client, playerIDs)
+		if err != nil {
+			log.Println("LeaderboardHandler: Could not get stats", err)
+			writeError(w, err)
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, g.Leaderboard(game, stats))
+	})
+}
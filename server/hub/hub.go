@@ -3,14 +3,20 @@ package hub
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/config"
 	"github.com/RobertDHanna/OpenCodenames/db"
 	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/RobertDHanna/OpenCodenames/patch"
+	"github.com/RobertDHanna/OpenCodenames/ratelimit"
+	"github.com/RobertDHanna/OpenCodenames/token"
 	"github.com/gorilla/websocket"
 )
 
@@ -26,11 +32,76 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 2048
+
+	// Time allowed for a player to authenticate after connecting.
+	authenticateWait = 10 * time.Second
 )
 
 // IncomingMessage represents actions players send to the server.
 type IncomingMessage struct {
-	Action string
+	Action   string
+	Token    string
+	Password string
+}
+
+// readAuthenticate waits for the "Authenticate" message a client sends first.
+func readAuthenticate(conn *websocket.Conn) (IncomingMessage, error) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(authenticateWait))
+	var message IncomingMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		return message, err
+	}
+	if message.Action != "Authenticate" {
+		return message, errors.New("NotAuthenticated")
+	}
+	return message, nil
+}
+
+// ReadToken waits for the "Authenticate" message a player sends first when their token wasn't in the
+// Authorization header, and returns its token.
+func ReadToken(conn *websocket.Conn) (string, error) {
+	message, err := readAuthenticate(conn)
+	if err != nil {
+		return "", err
+	}
+	if message.Token == "" {
+		return "", errors.New("NotAuthenticated")
+	}
+	return message.Token, nil
+}
+
+// ReadPassword waits for the "Authenticate" message a spectator sends first when the game asks spectators for its
+// room password, and returns that password. Passwords aren't taken from the URL, where they would end up in logs.
+func ReadPassword(conn *websocket.Conn) (string, error) {
+	message, err := readAuthenticate(conn)
+	if err != nil {
+		return "", err
+	}
+	return message.Password, nil
+}
+
+// Update is sent to clients that opted into delta updates. The first Update a client
+// receives is always a "snapshot" containing the full game, every Update after that
+// is a "patch" of RFC 6902 operations to apply on top of the game at BaseVersion.
+type Update struct {
+	Type        string
+	Version     int64
+	BaseVersion int64             `json:",omitempty"`
+	Game        interface{}       `json:",omitempty"`
+	Patch       []patch.Operation `json:",omitempty"`
+}
+
+// broadcast is what the hub hands to a client to send: the game and the cards the players currently suggest.
+type broadcast struct {
+	game        *db.Game
+	suggestions map[string]string // map of PlayerID to suggested word
+}
+
+// suggestion is a player pointing at a card for their teammates.
+type suggestion struct {
+	client *Client
+	word   string
 }
 
 // Client represents a player or spectator
@@ -42,8 +113,15 @@ type Client struct {
 	Conn          *websocket.Conn
 	Cancel        chan struct{}
 	SpectatorOnly bool
-	send          chan *db.Game
+	Delta         bool
+	Token         string
+	send          chan *broadcast
 	serverError   chan string
+	resync        chan struct{}
+	lastBroadcast *broadcast
+	lastView      interface{}
+	lastVersion   int64
+	actions       *ratelimit.Bucket
 }
 
 // NewClient creates a new client
@@ -56,12 +134,63 @@ func NewClient(gameID string, playerID string, sessionID string, hub *Hub, conn
 		Conn:          conn,
 		Cancel:        make(chan struct{}),
 		SpectatorOnly: spectator,
-		send:          make(chan *db.Game),
-		serverError:   make(chan string),
+		send:          make(chan *broadcast),
+		serverError:   make(chan string, 1),
+		resync:        make(chan struct{}, 1),
+		actions:       ratelimit.NewBucket(config.ActionsPerSecond(), time.Second),
 	}
 }
 
-func broadcastGame(c *Client, game *db.Game) error {
+// mapGameForClient returns the view of the game the client is allowed to see.
+func mapGameForClient(c *Client, b *broadcast) (*g.PlayerGame, error) {
+	game := b.game
+	if c.SpectatorOnly {
+		bg, err := g.MapGameToBaseGame(game)
+		if err != nil {
+			return nil, err
+		}
+		return &g.PlayerGame{BaseGame: *bg}, nil
+	}
+	view, err := g.MapGameForPlayer(game, c.PlayerID)
+	if err != nil {
+		return nil, err
+	}
+	view.TeamSuggestions = g.TeamSuggestions(game, c.PlayerID, b.suggestions)
+	return view, nil
+}
+
+func broadcastGame(c *Client, b *broadcast, forceSnapshot bool) error {
+	game := b.game
+	view, err := mapGameForClient(c, b)
+	if err != nil {
+		log.Println("mapGameForClient error", err)
+		return nil
+	}
+	var message interface{} = view
+	if c.Delta {
+		if game.Version < c.lastVersion && !forceSnapshot {
+			// A newer version has already been sent, this one is stale.
+			return nil
+		}
+		generic, err := patch.ToGeneric(view)
+		if err != nil {
+			return err
+		}
+		if c.lastView == nil || forceSnapshot {
+			message = Update{Type: "snapshot", Version: game.Version, Game: generic}
+		} else {
+			ops, err := patch.Diff(c.lastView, generic)
+			if err != nil {
+				return err
+			}
+			if len(ops) == 0 {
+				return nil
+			}
+			message = Update{Type: "patch", Version: game.Version, BaseVersion: c.lastVersion, Patch: ops}
+		}
+		c.lastView = generic
+		c.lastVersion = game.Version
+	}
 	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 	w, err := c.Conn.NextWriter(websocket.TextMessage)
 	if err != nil {
@@ -77,33 +206,8 @@ func broadcastGame(c *Client, game *db.Game) error {
 		}
 		return nil
 	}
-	if c.SpectatorOnly {
-		bg, err := g.MapGameToBaseGame(game)
-		if err != nil {
-			log.Println("MapGameToBaseGame error", err)
-		}
-		if err := send(w, g.PlayerGame{BaseGame: *bg}); err != nil {
-			return err
-		}
-	} else {
-		playerName := game.Players[c.PlayerID]
-		if game.TeamRedSpy == playerName || game.TeamBlueSpy == playerName {
-			sg, err := g.MapGameToSpyGame(game, c.PlayerID)
-			if err != nil {
-				log.Println("MapGameToSpyGame error", err)
-			}
-			if err := send(w, sg); err != nil {
-				return err
-			}
-		} else {
-			gg, err := g.MapGameToGuesserGame(game, c.PlayerID)
-			if err != nil {
-				log.Println("MapGameToGuesserGame error", err)
-			}
-			if err := send(w, gg); err != nil {
-				return err
-			}
-		}
+	if err := send(w, message); err != nil {
+		return err
 	}
 	if err := w.Close(); err != nil {
 		return err
@@ -134,33 +238,98 @@ func (c *Client) ReadPump() {
 			log.Println("Dropping connection, client encountered error", err)
 			break
 		}
+		if !c.actions.Allow() {
+			log.Println("Dropping action, client sent too many:", message.Action)
+			continue
+		}
+		if message.Action == "Resync" {
+			select {
+			case c.resync <- struct{}{}:
+			default:
+			}
+			continue
+		}
 		if c.SpectatorOnly {
 			log.Println("Spectator attempted action:", message)
 			continue
 		}
 		switch {
 		case message.Action == "StartGame":
-			game, ok := c.Hub.games[c.GameID]
-			if !ok {
+			game := c.Hub.game(c.GameID)
+			if game == nil {
 				log.Println("Error: could not find client game")
 				continue
 			}
 			log.Println("ReadPump:StartGame", game)
 			g.HandleGameStart(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
+		case strings.HasPrefix(message.Action, "SetGuessPolicy "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:SetGuessPolicy", game)
+			g.HandleSetGuessPolicy(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case strings.HasPrefix(message.Action, "SetRotationPolicy "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:SetRotationPolicy", game)
+			g.HandleSetRotationPolicy(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case strings.HasPrefix(message.Action, "Suggest"):
+			c.Hub.suggest <- suggestion{client: c, word: strings.TrimSpace(strings.TrimPrefix(message.Action, "Suggest"))}
+		case strings.HasPrefix(message.Action, "Clue "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:Clue", game)
+			g.HandleGiveClue(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
 		case strings.Contains(message.Action, "Guess"):
-			game := c.Hub.games[c.GameID]
+			game := c.Hub.game(c.GameID)
 			log.Println("ReadPump:HandleGuess", game)
-			g.HandlePlayerGuess(ctx, c.Hub.fireStoreClient, message.Action, c.PlayerID, game)
+			g.HandlePlayerGuess(ctx, c.Hub.fireStoreClient, message.Action, c.PlayerID, game, c.Hub.presence.players(c.GameID))
 		case message.Action == "EndTurn":
-			game := c.Hub.games[c.GameID]
+			game := c.Hub.game(c.GameID)
 			log.Println("ReadPump:EndTurn", game)
 			g.HandleEndTurn(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
 		case message.Action == "RestartGame":
-			game := c.Hub.games[c.GameID]
+			game := c.Hub.game(c.GameID)
 			log.Println("ReadPump:RestartGame", game)
 			g.HandleRestartGame(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
+		case message.Action == "ResetScoreboard":
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:ResetScoreboard", game)
+			g.HandleResetScoreboard(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
+		case message.Action == "ProposeUndo":
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:ProposeUndo", game)
+			g.HandleProposeUndo(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
+		case message.Action == "ApproveUndo":
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:ApproveUndo", game)
+			g.HandleApproveUndo(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
+		case message.Action == "RejectUndo":
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:RejectUndo", game)
+			g.HandleRejectUndo(ctx, c.Hub.fireStoreClient, game, c.PlayerID)
+		case message.Action == "RandomizeTeams" || message.Action == "BalanceTeams":
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:ShuffleTeams", game)
+			g.HandleShuffleTeams(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case message.Action == "LockTeams" || message.Action == "UnlockTeams":
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:LockTeams", game)
+			g.HandleLockTeams(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case strings.HasPrefix(message.Action, "SetVisibility "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:SetVisibility", game)
+			g.HandleSetVisibility(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case strings.HasPrefix(message.Action, "AllowTeamRequests "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:AllowTeamRequests", game)
+			g.HandleAllowTeamRequests(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case strings.HasPrefix(message.Action, "RequestTeam "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:RequestTeam", game)
+			g.HandleRequestTeam(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
+		case strings.HasPrefix(message.Action, "ApproveTeam ") || strings.HasPrefix(message.Action, "DenyTeam "):
+			game := c.Hub.game(c.GameID)
+			log.Println("ReadPump:AnswerTeamRequest", game)
+			g.HandleAnswerTeamRequest(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
 		case strings.Contains(message.Action, "UpdateTeam"):
-			game := c.Hub.games[c.GameID]
+			game := c.Hub.game(c.GameID)
 			log.Println("ReadPump:UpdateTeam", game)
 			g.HandleUpdateTeams(ctx, c.Hub.fireStoreClient, game, message.Action, c.PlayerID)
 		}
@@ -177,17 +346,26 @@ func (c *Client) WritePump() {
 	}()
 	for {
 		select {
-		case game, ok := <-c.send:
+		case b, ok := <-c.send:
 			if !ok {
 				// The hub closed the channel.
 				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-			err := broadcastGame(c, game)
+			c.lastBroadcast = b
+			err := broadcastGame(c, b, false)
 			if err != nil {
 				log.Println("broadcaseGame err:", err)
 				return
 			}
+		case <-c.resync:
+			if c.lastBroadcast == nil {
+				continue
+			}
+			if err := broadcastGame(c, c.lastBroadcast, true); err != nil {
+				log.Println("broadcaseGame err:", err)
+				return
+			}
 		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
@@ -201,14 +379,65 @@ func (c *Client) WritePump() {
 	}
 }
 
+// presence keeps track of which players have at least one connection open to a game. Unlike the rest of
+// the hub's state it is safe to read from the clients' goroutines.
+type presence struct {
+	sync.RWMutex
+	connections map[string]map[string]int // map of gameID to [map of PlayerID to number of connections]
+}
+
+func (p *presence) add(gameID string, playerID string) {
+	p.Lock()
+	defer p.Unlock()
+	if p.connections[gameID] == nil {
+		p.connections[gameID] = make(map[string]int)
+	}
+	p.connections[gameID][playerID]++
+}
+
+func (p *presence) remove(gameID string, playerID string) {
+	p.Lock()
+	defer p.Unlock()
+	p.connections[gameID][playerID]--
+	if p.connections[gameID][playerID] <= 0 {
+		delete(p.connections[gameID], playerID)
+	}
+	if len(p.connections[gameID]) == 0 {
+		delete(p.connections, gameID)
+	}
+}
+
+// players returns the set of IDs of the players connected to a game.
+func (p *presence) players(gameID string) map[string]bool {
+	p.RLock()
+	defer p.RUnlock()
+	players := make(map[string]bool, len(p.connections[gameID]))
+	for playerID := range p.connections[gameID] {
+		players[playerID] = true
+	}
+	return players
+}
+
+// games returns how many games have players connected to them.
+func (p *presence) games() int {
+	p.RLock()
+	defer p.RUnlock()
+	return len(p.connections)
+}
+
 // Hub manages clients and connections by game
 type Hub struct {
 	clients         map[string]map[string]*Client // map of gameID to [map of PlayerID to Client]
-	games           map[string]*db.Game           // map of gameID to Game
+	games           map[string]*db.Game           // map of gameID to Game, only changed by Run
+	gamesMu         sync.RWMutex                  // guards games, which clients read from their own goroutines
+	suggestions     map[string]map[string]string  // map of gameID to [map of PlayerID to suggested word]
+	presence        *presence
 	fireStoreClient *firestore.Client
 	gameBroadcast   chan *db.Game
 	Register        chan *Client
 	unregister      chan *Client
+	suggest         chan suggestion
+	expire          chan string
 }
 
 // NewHub creates a new hub
@@ -216,19 +445,122 @@ func NewHub(client *firestore.Client) *Hub {
 	return &Hub{
 		clients:         map[string]map[string]*Client{},
 		games:           map[string]*db.Game{},
+		suggestions:     map[string]map[string]string{},
+		presence:        &presence{connections: map[string]map[string]int{}},
 		fireStoreClient: client,
 		Register:        make(chan *Client),
 		gameBroadcast:   make(chan *db.Game),
 		unregister:      make(chan *Client),
+		suggest:         make(chan suggestion),
+		expire:          make(chan string),
 	}
 }
 
+// send hands a game to a client, dropping the client if it can't keep up.
+func (h *Hub) send(client *Client, b *broadcast) {
+	select {
+	case client.send <- b:
+	default:
+		log.Println("Client may be blocking, dropping connection")
+		reapClient(client, h)
+	}
+}
+
+// broadcastToTeam sends a game only to the players that are on the given team.
+func (h *Hub) broadcastToTeam(game *db.Game, team map[string]string) {
+	b := &broadcast{game: game, suggestions: h.suggestions[game.ID]}
+	for _, client := range h.clients[game.ID] {
+		if _, onTeam := team[client.PlayerID]; onTeam && !client.SpectatorOnly {
+			h.send(client, b)
+		}
+	}
+}
+
+// pruneSuggestions forgets suggestions that no longer make sense once a game changed.
+func (h *Hub) pruneSuggestions(previous *db.Game, game *db.Game) {
+	if previous == nil || previous.WhoseTurn != game.WhoseTurn || previous.Status != game.Status {
+		delete(h.suggestions, game.ID)
+		return
+	}
+	suggestions := map[string]string{}
+	for playerID, word := range h.suggestions[game.ID] {
+		if card, ok := game.Cards[word]; ok && !card.Guessed {
+			suggestions[playerID] = word
+		}
+	}
+	h.suggestions[game.ID] = suggestions
+}
+
 func reapClient(client *Client, hub *Hub) {
-	if _, ok := hub.clients[client.GameID][client.SessionID]; ok {
+	if existing, ok := hub.clients[client.GameID][client.SessionID]; ok && existing == client {
 		log.Println("Removing client from hub")
 		close(client.send)
 		delete(hub.clients[client.GameID], client.SessionID)
+		if !client.SpectatorOnly {
+			hub.presence.remove(client.GameID, client.PlayerID)
+		}
+		if len(hub.clients[client.GameID]) == 0 {
+			// Nobody is watching the game anymore, stop keeping it in memory.
+			delete(hub.clients, client.GameID)
+			hub.forgetGame(client.GameID)
+			delete(hub.suggestions, client.GameID)
+		}
+	}
+}
+
+// register adds a client whose access to the game was checked, replacing the connection it reconnects from.
+func (h *Hub) register(client *Client, game *db.Game) {
+	if existing, ok := h.clients[game.ID][client.SessionID]; ok {
+		// Only the same player may take over a player's session, so a leaked session ID can't be used to kick
+		// them out. Spectators get a new ID on every connection, so they can only be matched by session.
+		if existing.SpectatorOnly != client.SpectatorOnly || (!client.SpectatorOnly && existing.PlayerID != client.PlayerID) {
+			log.Println("Client Registration: Session belongs to someone else")
+			client.serverError <- "session in use"
+			return
+		}
+		reapClient(existing, h)
+	}
+	// Reaping the only client of a game forgets the game, so its map is looked up after the takeover.
+	if h.clients[game.ID] == nil {
+		h.clients[game.ID] = make(map[string]*Client)
+	}
+	h.clients[game.ID][client.SessionID] = client
+	if !client.SpectatorOnly {
+		h.presence.add(game.ID, client.PlayerID)
+	}
+	if previous, ok := h.games[game.ID]; !ok || previous.Version <= game.Version {
+		h.pruneSuggestions(previous, game)
+		h.setGame(game)
 	}
+	client.send <- &broadcast{game: game, suggestions: h.suggestions[game.ID]}
+	log.Println("Finished client registration")
+}
+
+// game returns the latest version of a game that has clients, or nil. Clients call it from their own goroutines
+// while Run replaces and forgets games, so it takes gamesMu.
+func (h *Hub) game(gameID string) *db.Game {
+	h.gamesMu.RLock()
+	defer h.gamesMu.RUnlock()
+	return h.games[gameID]
+}
+
+// setGame stores the latest version of a game. Only Run may call it.
+func (h *Hub) setGame(game *db.Game) {
+	h.gamesMu.Lock()
+	defer h.gamesMu.Unlock()
+	h.games[game.ID] = game
+}
+
+// forgetGame drops a game nobody is connected to anymore. Only Run may call it.
+func (h *Hub) forgetGame(gameID string) {
+	h.gamesMu.Lock()
+	defer h.gamesMu.Unlock()
+	delete(h.games, gameID)
+}
+
+// ActiveGames returns how many games are being played right now. It is safe to call from any goroutine.
+func (h *Hub) ActiveGames() int {
+	return h.presence.games()
 }
 
 // Run starts the hub
@@ -242,15 +574,37 @@ func (h *Hub) Run() {
 		// When a game changes, messages are pushed onto this channel to be broadcasted to
 		// all participants
 		case game := <-h.gameBroadcast:
+			if len(h.clients[game.ID]) == 0 {
+				continue
+			}
 			log.Println("Broadcasting game change", game)
-			h.games[game.ID] = game
+			h.pruneSuggestions(h.games[game.ID], game)
+			h.setGame(game)
+			b := &broadcast{game: game, suggestions: h.suggestions[game.ID]}
 			for _, client := range h.clients[game.ID] {
-				select {
-				case client.send <- game:
-				default:
-					log.Println("Client may be blocking, dropping connection")
-					reapClient(client, h)
-				}
+				h.send(client, b)
+			}
+		// When a player points at a card, only their teammates are told about it
+		case s := <-h.suggest:
+			game, ok := h.games[s.client.GameID]
+			if !ok || !g.PlayerCanSuggest(game, s.client.PlayerID, s.word) {
+				continue
+			}
+			// Suggestions are replaced rather than modified since clients may still be reading the old ones.
+			suggestions := map[string]string{}
+			for playerID, word := range h.suggestions[game.ID] {
+				suggestions[playerID] = word
+			}
+			if s.word == "" || suggestions[s.client.PlayerID] == s.word {
+				delete(suggestions, s.client.PlayerID)
+			} else {
+				suggestions[s.client.PlayerID] = s.word
+			}
+			h.suggestions[game.ID] = suggestions
+			if _, onTeamRed := game.TeamRed[s.client.PlayerID]; onTeamRed {
+				h.broadcastToTeam(game, game.TeamRed)
+			} else {
+				h.broadcastToTeam(game, game.TeamBlue)
 			}
 		// When a client wants to join a game they push themselves onto this channel
 		case client := <-h.Register:
@@ -261,22 +615,34 @@ func (h *Hub) Run() {
 				client.serverError <- "could not find game"
 				continue
 			}
-			if _, ok := game.Players[client.PlayerID]; !ok && !client.SpectatorOnly {
-				log.Println("Client Registration: Player does not belong to game and is not spectator", err)
-				client.serverError <- "access denied"
-				continue
-			}
-			if h.clients[game.ID] == nil {
-				h.clients[game.ID] = make(map[string]*Client)
+			if !client.SpectatorOnly {
+				claims, err := token.Verify(client.Token)
+				if err != nil || claims.GameID != client.GameID || claims.PlayerID != client.PlayerID {
+					log.Println("Client Registration: Player token is not valid for this game", err)
+					client.serverError <- "access denied"
+					continue
+				}
+				if _, ok := game.Players[client.PlayerID]; !ok {
+					log.Println("Client Registration: Player does not belong to game and is not spectator")
+					client.serverError <- "access denied"
+					continue
+				}
 			}
-			h.clients[game.ID][client.SessionID] = client
-			client.send <- game
-			h.games[game.ID] = game
-			log.Println("Finished client registration")
+			h.register(client, game)
 		// When a client leaves a game or we decide to close the connection
 		case client := <-h.unregister:
 			log.Println("Client unregistration", client)
 			reapClient(client, h)
+		// When a game is deleted, its remaining clients are told and disconnected
+		case gameID := <-h.expire:
+			h.forgetGame(gameID)
+			delete(h.suggestions, gameID)
+			for _, client := range h.clients[gameID] {
+				select {
+				case client.serverError <- "game expired":
+				default:
+				}
+			}
 		}
 	}
 }
@@ -302,7 +668,7 @@ func (h *Hub) ListenToGames() {
 				}
 				h.gameBroadcast <- &game
 			case firestore.DocumentRemoved:
-				continue
+				h.expire <- change.Doc.Ref.ID
 			}
 		}
 	}
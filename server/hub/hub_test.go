@@ -0,0 +1,123 @@
+package hub
+
+import (
+	"testing"
+
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// connect registers a client without a WebSocket, reading what the hub sends it until the hub lets go of it.
+func connect(t *testing.T, hub *Hub, game *db.Game, playerID string, sessionID string, spectator bool) (*Client, chan struct{}) {
+	t.Helper()
+	client := NewClient(game.ID, playerID, sessionID, hub, nil, spectator)
+	released := make(chan struct{})
+	go func() {
+		for range client.send {
+		}
+		close(released)
+	}()
+	hub.register(client, game)
+	return client, released
+}
+
+func TestRegisterTakesOverSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		spectator bool
+		players   [2]string
+	}{
+		{"player reconnects", false, [2]string{"p1", "p1"}},
+		// Spectators get a new ID on every connection.
+		{"spectator reconnects", true, [2]string{"s1", "s2"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hub := NewHub(nil)
+			game := &db.Game{ID: "game", Version: 1, Players: map[string]string{"p1": "ann"}}
+			first, firstReleased := connect(t, hub, game, test.players[0], "session", test.spectator)
+			second, _ := connect(t, hub, game, test.players[1], "session", test.spectator)
+
+			<-firstReleased
+			if hub.clients[game.ID]["session"] != second {
+				t.Errorf("the session belongs to %v, want the new connection", hub.clients[game.ID]["session"])
+			}
+			if hub.clients[game.ID]["session"] == first {
+				t.Error("the old connection is still registered")
+			}
+			if _, ok := hub.games[game.ID]; !ok {
+				t.Error("the hub forgot the game")
+			}
+			wantGames := 1
+			if test.spectator {
+				wantGames = 0
+			}
+			if got := hub.ActiveGames(); got != wantGames {
+				t.Errorf("%d active games, want %d", got, wantGames)
+			}
+			if players := hub.presence.players(game.ID); !test.spectator && (len(players) != 1 || !players["p1"]) {
+				t.Errorf("connected players %v, want p1 once", players)
+			}
+		})
+	}
+}
+
+func TestRegisterRefusesSomeoneElsesSession(t *testing.T) {
+	hub := NewHub(nil)
+	game := &db.Game{ID: "game", Version: 1, Players: map[string]string{"p1": "ann", "p2": "bob"}}
+	first, _ := connect(t, hub, game, "p1", "session", false)
+	intruder := NewClient(game.ID, "p2", "session", hub, nil, false)
+	hub.register(intruder, game)
+
+	if reason := <-intruder.serverError; reason != "session in use" {
+		t.Errorf("intruder was told %q", reason)
+	}
+	if hub.clients[game.ID]["session"] != first {
+		t.Error("the session was taken over by another player")
+	}
+}
+
+func TestReapForgetsGameWithoutClients(t *testing.T) {
+	hub := NewHub(nil)
+	game := &db.Game{ID: "game", Version: 1, Players: map[string]string{"p1": "ann"}}
+	client, released := connect(t, hub, game, "p1", "session", false)
+	reapClient(client, hub)
+	<-released
+	if _, ok := hub.clients[game.ID]; ok {
+		t.Error("the hub still keeps the game's clients")
+	}
+	if _, ok := hub.games[game.ID]; ok {
+		t.Error("the hub still keeps the game")
+	}
+	if hub.ActiveGames() != 0 {
+		t.Error("the game is still active")
+	}
+}
+
+// TestGameLookupWhileReaping is meant for go test -race: clients look games up from their own goroutines while
+// the hub replaces and forgets them.
+func TestGameLookupWhileReaping(t *testing.T) {
+	hub := NewHub(nil)
+	game := &db.Game{ID: "game", Version: 1, Players: map[string]string{"p1": "ann"}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			client, released := connect(t, hub, game, "p1", "session", false)
+			reapClient(client, hub)
+			<-released
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if hub.game(game.ID) != nil {
+				t.Error("the hub still keeps the game")
+			}
+			return
+		default:
+			if found := hub.game(game.ID); found != nil && found != game {
+				t.Errorf("found %+v, want the registered game", found)
+			}
+		}
+	}
+}
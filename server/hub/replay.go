@@ -0,0 +1,170 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/RobertDHanna/OpenCodenames/game"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time between two moves of a replay played at speed 1.
+	replayStepInterval = 2 * time.Second
+
+	// Bounds for the speed a replay can be played at.
+	minReplaySpeed = 0.25
+	maxReplaySpeed = 16
+)
+
+// ReplayClient represents a spectator watching a finished round move by move. Replays don't
+// need the hub since the game they show doesn't change anymore.
+type ReplayClient struct {
+	Conn    *websocket.Conn
+	frames  []g.PlayerGame
+	control chan string
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewReplayClient creates a new replay client
+func NewReplayClient(conn *websocket.Conn, frames []g.PlayerGame) *ReplayClient {
+	return &ReplayClient{
+		Conn:    conn,
+		frames:  frames,
+		control: make(chan string),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// ClampReplaySpeed keeps a requested replay speed within the supported bounds. NaN plays at normal speed.
+func ClampReplaySpeed(speed float64) float64 {
+	if math.IsNaN(speed) {
+		return 1
+	}
+	if speed < minReplaySpeed {
+		return minReplaySpeed
+	}
+	if speed > maxReplaySpeed {
+		return maxReplaySpeed
+	}
+	return speed
+}
+
+// ParseReplaySpeed parses a requested replay speed and clamps it, refusing values that aren't numbers.
+func ParseReplaySpeed(value string) (float64, error) {
+	speed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(speed) || math.IsInf(speed, 0) {
+		return 0, errors.New("replay speed must be a finite number")
+	}
+	return ClampReplaySpeed(speed), nil
+}
+
+// ReadPump reads playback controls: "Pause", "Play", "Step", "Restart" and "Speed <multiplier>".
+func (r *ReplayClient) ReadPump() {
+	defer func() {
+		close(r.done)
+		r.Conn.Close()
+	}()
+	r.Conn.SetReadLimit(maxMessageSize)
+	r.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	r.Conn.SetPongHandler(func(string) error {
+		r.Conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	for {
+		var message IncomingMessage
+		if err := r.Conn.ReadJSON(&message); err != nil {
+			log.Println("Dropping replay connection, client encountered error", err)
+			return
+		}
+		select {
+		case r.control <- message.Action:
+		case <-r.stopped:
+			return
+		}
+	}
+}
+
+// WritePump sends one frame of the replay per step until the round is over.
+func (r *ReplayClient) WritePump(speed float64) {
+	ticker := time.NewTicker(pingPeriod)
+	step := time.NewTimer(0)
+	defer func() {
+		ticker.Stop()
+		step.Stop()
+		close(r.stopped)
+		r.Conn.Close()
+	}()
+	speed = ClampReplaySpeed(speed)
+	interval := func() time.Duration {
+		return time.Duration(float64(replayStepInterval) / speed)
+	}
+	next := 0
+	paused := false
+	sendFrame := func() bool {
+		if next >= len(r.frames) {
+			return true
+		}
+		r.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := r.Conn.WriteJSON(r.frames[next]); err != nil {
+			log.Println("replay write err:", err)
+			return false
+		}
+		next++
+		return true
+	}
+	for {
+		select {
+		case <-step.C:
+			if paused || next >= len(r.frames) {
+				continue
+			}
+			if !sendFrame() {
+				return
+			}
+			step.Reset(interval())
+		case action := <-r.control:
+			switch {
+			case action == "Pause":
+				paused = true
+			case action == "Play":
+				paused = false
+				step.Reset(0)
+			case action == "Step":
+				paused = true
+				if !sendFrame() {
+					return
+				}
+			case action == "Restart":
+				next = 0
+				step.Reset(0)
+			case strings.HasPrefix(action, "Speed "):
+				newSpeed, err := ParseReplaySpeed(strings.TrimPrefix(action, "Speed "))
+				if err != nil {
+					log.Println("Received an invalid replay speed", action)
+					continue
+				}
+				speed = newSpeed
+				if !paused {
+					step.Reset(interval())
+				}
+			}
+		case <-ticker.C:
+			r.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := r.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package hub
+
+import "testing"
+
+func TestParseReplaySpeed(t *testing.T) {
+	tests := []struct {
+		value string
+		speed float64
+		ok    bool
+	}{
+		{"1", 1, true},
+		{"2.5", 2.5, true},
+		{"0", minReplaySpeed, true},
+		{"-3", minReplaySpeed, true},
+		{"1000", maxReplaySpeed, true},
+		{"NaN", 0, false},
+		{"nan", 0, false},
+		{"Inf", 0, false},
+		{"-Inf", 0, false},
+		{"+Infinity", 0, false},
+		{"fast", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		speed, err := ParseReplaySpeed(test.value)
+		if (err == nil) != test.ok || speed != test.speed {
+			t.Errorf("ParseReplaySpeed(%q) = %v, %v, want %v (ok %v)", test.value, speed, err, test.speed, test.ok)
+		}
+	}
+}
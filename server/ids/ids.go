@@ -0,0 +1,171 @@
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+// Alphabet game IDs are made of. Only consonants are used, so IDs can't spell words, and letters that are
+// easily confused with digits or each other when read aloud are left out.
+const Alphabet = "BCDFGHJKMNPQRSTVWXZ"
+
+const (
+	// MinLength is the length of game IDs while few games are played
+	MinLength = 5
+	// MaxLength is the longest game ID handed out
+	MaxLength = 10
+	// maxOccupancy is the share of possible IDs that may be in use before IDs get longer, which keeps
+	// the chance of picking a taken ID (and of guessing a real one) below it.
+	maxOccupancy = 0.001
+	// maxAttempts is how many IDs are tried before giving up.
+	maxAttempts = 8
+)
+
+// Letter combinations that read as something offensive even without vowels.
+var blocklist = []string{
+	"FCK", "FKN", "FKR", "FGT", "CNT", "KNT", "DCK", "CCK", "SHT", "PSS", "TWT", "WNK", "BTCH", "BCH",
+	"NGR", "NGG", "KKK", "SXX", "XXX", "PRN", "STFU", "GTFO", "WTF", "DMN", "TTS", "JZZ", "RPD",
+	"CMS", "PNS", "VGN",
+}
+
+// ErrTaken is returned by the function given to Allocate when the ID it was given is already used.
+var ErrTaken = errors.New("GameAlreadyExists")
+
+// ErrExhausted is returned by Allocate when every ID it tried was taken.
+var ErrExhausted = errors.New("GameIDsExhausted")
+
+// Allocator hands out game IDs that are random, easy to read out and grow longer as more games are played.
+// Whether an ID is free is decided by the function given to Allocate, which is expected to check the database
+// (see db.CreateGame), so Occupancy only has to estimate how many IDs are in use.
+type Allocator struct {
+	// Occupancy estimates how many game IDs are in use. The server passes the number of games being played,
+	// which leaves out idle games that are still stored.
+	Occupancy func() int
+
+	mu        sync.Mutex
+	minLength int // raised when IDs of the estimated length kept being taken
+}
+
+// NewAllocator creates an allocator that sizes IDs according to the given occupancy.
+func NewAllocator(occupancy func() int) *Allocator {
+	return &Allocator{Occupancy: occupancy}
+}
+
+// Length returns the length of new IDs: the shortest one whose possible IDs are hardly occupied by the
+// given number of games.
+func Length(occupancy int) int {
+	for length := MinLength; length < MaxLength; length++ {
+		if float64(occupancy) <= maxOccupancy*math.Pow(float64(len(Alphabet)), float64(length)) {
+			return length
+		}
+	}
+	return MaxLength
+}
+
+// Allocate calls create with new IDs until it doesn't return ErrTaken, and returns the ID it accepted.
+// Every other error is returned as is. When IDs keep being taken they get longer, and since that means
+// Occupancy underestimates how many IDs are used, later IDs start at that length too.
+func (a *Allocator) Allocate(create func(id string) error) (string, error) {
+	occupancy := 0
+	if a.Occupancy != nil {
+		occupancy = a.Occupancy()
+	}
+	length := Length(occupancy)
+	a.mu.Lock()
+	if a.minLength > length {
+		length = a.minLength
+	}
+	a.mu.Unlock()
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 && attempt%2 == 0 && length < MaxLength {
+			// Collisions are rare enough at the chosen length that several in a row mean it's too short.
+			length++
+		}
+		id, err := New(length)
+		if err != nil {
+			return "", err
+		}
+		err = create(id)
+		if err != ErrTaken {
+			if err != nil {
+				return "", err
+			}
+			if attempt >= 2 {
+				a.mu.Lock()
+				if length > a.minLength {
+					a.minLength = length
+				}
+				a.mu.Unlock()
+			}
+			return id, nil
+		}
+	}
+	return "", ErrExhausted
+}
+
+// New returns a random ID of the given length that doesn't contain anything on the blocklist.
+func New(length int) (string, error) {
+	if length < 1 {
+		return "", errors.New("cannot pass in length < 1")
+	}
+	for {
+		id, err := randomString(Alphabet, length)
+		if err != nil {
+			return "", err
+		}
+		if !blocked(id) {
+			return id, nil
+		}
+	}
+}
+
+func blocked(id string) bool {
+	for _, word := range blocklist {
+		if strings.Contains(id, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func randomString(alphabet string, length int) (string, error) {
+	var id strings.Builder
+	max := big.NewInt(int64(len(alphabet)))
+	for i := 0; i < length; i++ {
+		index, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		id.WriteByte(alphabet[index.Int64()])
+	}
+	return id.String(), nil
+}
+
+// NewSecret returns a random 128-bit identifier, hex encoded, for IDs that double as credentials such as
+// player IDs. Unlike game IDs these are never typed or read out.
+func NewSecret() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// LegacyPlayerID reports whether id is a player ID from before they were secrets: 15 letters from A to Z.
+func LegacyPlayerID(id string) bool {
+	return len(id) == 15 && strings.Trim(id, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+// Seed returns a random seed for math/rand, which shuffles boards and teams and must not be predictable
+// from the time the server started.
+func Seed() (int64, error) {
+	var seed int64
+	err := binary.Read(rand.Reader, binary.LittleEndian, &seed)
+	return seed, err
+}
@@ -0,0 +1,114 @@
+package ids
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		occupancy int
+		want      int
+	}{
+		{0, MinLength},
+		{2476, MinLength},
+		{2477, MinLength + 1},
+		{1 << 62, MaxLength},
+	}
+	for _, test := range tests {
+		if got := Length(test.occupancy); got != test.want {
+			t.Errorf("Length(%d) = %d, want %d", test.occupancy, got, test.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	failure := errors.New("unavailable")
+	tests := []struct {
+		name    string
+		taken   int // how many IDs create refuses before accepting one
+		err     error
+		wantErr error
+		wantLen int
+	}{
+		{"free", 0, nil, nil, MinLength},
+		{"stored game", 1, nil, nil, MinLength},
+		{"several stored games", 2, nil, nil, MinLength + 1},
+		{"all taken", maxAttempts, nil, ErrExhausted, 0},
+		{"other error", 0, failure, failure, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			allocator := NewAllocator(func() int { return 0 })
+			calls := 0
+			id, err := allocator.Allocate(func(id string) error {
+				calls++
+				if calls <= test.taken {
+					return ErrTaken
+				}
+				return test.err
+			})
+			if err != test.wantErr {
+				t.Fatalf("Allocate: %v, want %v", err, test.wantErr)
+			}
+			if len(id) != test.wantLen || strings.Trim(id, Alphabet) != "" {
+				t.Errorf("Allocate = %q, want %d letters of the alphabet", id, test.wantLen)
+			}
+		})
+	}
+}
+
+func TestAllocateRemembersTakenLength(t *testing.T) {
+	allocator := NewAllocator(func() int { return 0 })
+	calls := 0
+	if _, err := allocator.Allocate(func(string) error {
+		if calls++; calls <= 2 {
+			return ErrTaken
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	id, err := allocator.Allocate(func(string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(id) != MinLength+1 {
+		t.Errorf("%q after IDs kept being taken, want %d letters", id, MinLength+1)
+	}
+}
+
+func TestNewAvoidsBlocklist(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		id, err := New(MinLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blocked(id) {
+			t.Fatalf("New returned blocked ID %q", id)
+		}
+	}
+}
+
+func TestLegacyPlayerID(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"QWERTYUIOPASDFG", true},
+		{secret, false},
+		{"QWERTYUIOPASDF", false},
+		{"qwertyuiopasdfg", false},
+		{"QWERTYUIOPASDF1", false},
+	}
+	for _, test := range tests {
+		if got := LegacyPlayerID(test.id); got != test.want {
+			t.Errorf("LegacyPlayerID(%q) = %v, want %v", test.id, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package janitor
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/RobertDHanna/OpenCodenames/config"
+	"github.com/RobertDHanna/OpenCodenames/db"
+)
+
+// batchSize is how many idle games or expired sessions are looked up at a time.
+const batchSize = 100
+
+// Run removes idle games and expired sessions every config.JanitorInterval(). The Hub notices the removals and
+// disconnects anyone still connected to those games.
+func Run(client *firestore.Client) {
+	ticker := time.NewTicker(config.JanitorInterval())
+	defer ticker.Stop()
+	for {
+		Sweep(context.Background(), client, time.Now())
+		SweepSessions(context.Background(), client, time.Now())
+		<-ticker.C
+	}
+}
+
+// SweepSessions removes the sessions and magic links that expired and returns how many it removed.
+func SweepSessions(ctx context.Context, client *firestore.Client, now time.Time) int {
+	removed := 0
+	for {
+		deleted, err := db.DeleteExpiredSessions(ctx, client, now.Unix(), batchSize)
+		if err != nil {
+			log.Println("Janitor: Could not remove expired sessions", err)
+			break
+		}
+		removed += deleted
+		if deleted < batchSize {
+			break
+		}
+	}
+	if removed > 0 {
+		log.Printf("Janitor: Removed %d expired sessions", removed)
+	}
+	return removed
+}
+
+// Sweep removes every game that has been idle for longer than config.GameTTL() and returns how many it removed.
+func Sweep(ctx context.Context, client *firestore.Client, now time.Time) int {
+	before := now.Add(-config.GameTTL()).Unix()
+	archive := config.ArchiveExpiredGames()
+	removed := 0
+	for {
+		gameIDs, err := db.ListIdleGames(ctx, client, before, batchSize)
+		if err != nil {
+			log.Println("Janitor: Could not list idle games", err)
+			return removed
+		}
+		expired := 0
+		for _, gameID := range gameIDs {
+			if err := db.ExpireGame(ctx, client, gameID, before, archive); err != nil {
+				log.Println("Janitor: Could not expire game", gameID, err)
+				continue
+			}
+			expired++
+		}
+		removed += expired
+		// Stop when there is nothing left, or when nothing could be removed so the same games don't come back forever.
+		if len(gameIDs) < batchSize || expired == 0 {
+			break
+		}
+	}
+	if removed > 0 {
+		log.Printf("Janitor: Removed %d idle games", removed)
+	}
+	return removed
+}
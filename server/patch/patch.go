@@ -0,0 +1,182 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Operation represents a single RFC 6902 JSON Patch operation.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// ToGeneric round-trips a value through JSON so it can be compared with Diff.
+func ToGeneric(thing interface{}) (interface{}, error) {
+	j, err := json.Marshal(thing)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(j, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// Diff returns the operations needed to turn from into to. Both values must be
+// generic JSON values as produced by ToGeneric.
+func Diff(from interface{}, to interface{}) ([]Operation, error) {
+	ops := []Operation{}
+	if err := diff("", from, to, &ops); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func diff(path string, from interface{}, to interface{}, ops *[]Operation) error {
+	if reflect.DeepEqual(from, to) {
+		return nil
+	}
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		keys := make([]string, 0, len(fromMap)+len(toMap))
+		for key := range fromMap {
+			keys = append(keys, key)
+		}
+		for key := range toMap {
+			if _, ok := fromMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			childPath := path + "/" + escape(key)
+			fromValue, inFrom := fromMap[key]
+			toValue, inTo := toMap[key]
+			switch {
+			case inFrom && !inTo:
+				*ops = append(*ops, Operation{Op: "remove", Path: childPath})
+			case !inFrom && inTo:
+				if err := appendValue(ops, "add", childPath, toValue); err != nil {
+					return err
+				}
+			default:
+				if err := diff(childPath, fromValue, toValue, ops); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	fromSlice, fromIsSlice := from.([]interface{})
+	toSlice, toIsSlice := to.([]interface{})
+	if fromIsSlice && toIsSlice && len(toSlice) > len(fromSlice) && reflect.DeepEqual(fromSlice, toSlice[:len(fromSlice)]) {
+		// Only new elements were appended, so there's no need to resend the whole slice.
+		for _, value := range toSlice[len(fromSlice):] {
+			if err := appendValue(ops, "add", path+"/-", value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return appendValue(ops, "replace", path, to)
+}
+
+func appendValue(ops *[]Operation, op string, path string, value interface{}) error {
+	j, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	*ops = append(*ops, Operation{Op: op, Path: path, Value: j})
+	return nil
+}
+
+// Apply applies operations produced by Diff to a generic JSON value and returns the result. It may modify document.
+// Clients that opt into delta updates have to do the same, this is the reference they are checked against.
+func Apply(document interface{}, ops []Operation) (interface{}, error) {
+	for _, op := range ops {
+		var value interface{}
+		if op.Op != "remove" {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, err
+			}
+		}
+		if op.Path == "" {
+			if op.Op == "remove" {
+				return nil, errors.New("cannot remove the document root")
+			}
+			document = value
+			continue
+		}
+		tokens := strings.Split(op.Path, "/")[1:]
+		var err error
+		document, err = apply(document, tokens, op.Op, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return document, nil
+}
+
+func apply(node interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	key := unescape(tokens[0])
+	last := len(tokens) == 1
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		if last {
+			if op == "remove" {
+				delete(typed, key)
+			} else {
+				typed[key] = value
+			}
+			return typed, nil
+		}
+		child, ok := typed[key]
+		if !ok {
+			return nil, errors.New("patch path not found: " + key)
+		}
+		updated, err := apply(child, tokens[1:], op, value)
+		if err != nil {
+			return nil, err
+		}
+		typed[key] = updated
+		return typed, nil
+	case []interface{}:
+		if last && key == "-" && op == "add" {
+			return append(typed, value), nil
+		}
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(typed) {
+			return nil, errors.New("patch index out of range: " + key)
+		}
+		if last {
+			if op == "remove" {
+				return append(typed[:index], typed[index+1:]...), nil
+			}
+			typed[index] = value
+			return typed, nil
+		}
+		updated, err := apply(typed[index], tokens[1:], op, value)
+		if err != nil {
+			return nil, err
+		}
+		typed[index] = updated
+		return typed, nil
+	}
+	return nil, errors.New("patch path does not point into an object or array")
+}
+
+func escape(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+func unescape(token string) string {
+	return strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+}
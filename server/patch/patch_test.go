@@ -0,0 +1,76 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func generic(t *testing.T, document string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		t.Fatalf("bad document %s: %v", document, err)
+	}
+	return value
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		ops  []string // op and path of each expected operation
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"a":1,"b":[1,2]}`, nil},
+		{"changed field", `{"a":1,"b":2}`, `{"a":1,"b":3}`, []string{"replace /b"}},
+		{"added and removed fields", `{"a":1,"b":2}`, `{"b":2,"c":3}`, []string{"remove /a", "add /c"}},
+		{"nested", `{"cards":{"ocean":{"guessed":false}}}`, `{"cards":{"ocean":{"guessed":true}}}`, []string{"replace /cards/ocean/guessed"}},
+		{"appended", `{"events":[1,2]}`, `{"events":[1,2,3,4]}`, []string{"add /events/-", "add /events/-"}},
+		{"reordered", `{"players":["a","b"]}`, `{"players":["b","a"]}`, []string{"replace /players"}},
+		{"shrunk", `{"players":["a","b"]}`, `{"players":["a"]}`, []string{"replace /players"}},
+		{"escaped key", `{"a/b~c":1}`, `{"a/b~c":2}`, []string{"replace /a~1b~0c"}},
+		{"root", `1`, `"x"`, []string{"replace "}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops, err := Diff(generic(t, test.from), generic(t, test.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, op := range ops {
+				got = append(got, op.Op+" "+op.Path)
+			}
+			if !reflect.DeepEqual(got, test.ops) {
+				t.Errorf("Diff(%s, %s) = %v, want %v", test.from, test.to, got, test.ops)
+			}
+			applied, err := Apply(generic(t, test.from), ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := generic(t, test.to); !reflect.DeepEqual(applied, want) {
+				t.Errorf("Apply(%s, Diff) = %v, want %v", test.from, applied, want)
+			}
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []Operation
+	}{
+		{"missing path", []Operation{{Op: "replace", Path: "/missing/field", Value: json.RawMessage(`1`)}}},
+		{"index out of range", []Operation{{Op: "replace", Path: "/list/5", Value: json.RawMessage(`1`)}}},
+		{"into a scalar", []Operation{{Op: "replace", Path: "/number/field", Value: json.RawMessage(`1`)}}},
+		{"remove root", []Operation{{Op: "remove", Path: ""}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Apply(generic(t, `{"list":[1],"number":1}`), test.ops); err == nil {
+				t.Error("Apply succeeded, want an error")
+			}
+		})
+	}
+}
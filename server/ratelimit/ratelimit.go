@@ -0,0 +1,120 @@
+// Package ratelimit keeps token buckets in memory to limit how often clients may do something, e.g. create games.
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RobertDHanna/OpenCodenames/utils"
+)
+
+// ErrLimited is returned when a key ran out of tokens.
+var ErrLimited = errors.New("TooManyRequests")
+
+// Bucket holds up to n tokens and earns them back at n per period. It isn't safe for concurrent use, Limiter
+// guards the buckets it keeps.
+type Bucket struct {
+	capacity float64
+	perToken time.Duration
+	tokens   float64
+	last     time.Time
+}
+
+// NewBucket returns a full bucket of n tokens that earns them back at n per period. A bucket of n <= 0 tokens or
+// of a period <= 0 never runs out, which lets limits be turned off.
+func NewBucket(n int, per time.Duration) *Bucket {
+	if unlimited(n, per) {
+		return &Bucket{}
+	}
+	return &Bucket{capacity: float64(n), perToken: per / time.Duration(n), tokens: float64(n), last: time.Now()}
+}
+
+// unlimited reports whether n tokens per period means no limit at all.
+func unlimited(n int, per time.Duration) bool {
+	return n <= 0 || per <= 0
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if b.perToken > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+float64(now.Sub(b.last))/float64(b.perToken))
+	}
+	b.last = now
+}
+
+// Allow takes a token if there is one left.
+func (b *Bucket) Allow() bool {
+	if b.perToken <= 0 {
+		return true
+	}
+	b.refill(time.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Limiter keeps a Bucket per key, e.g. per IP or per game.
+type Limiter struct {
+	mu      sync.Mutex
+	n       int
+	per     time.Duration
+	buckets map[string]*Bucket
+	pruned  time.Time
+}
+
+// New returns a Limiter that lets each key do something n times per period, all at once or spread out. n <= 0
+// means no limit.
+func New(n int, per time.Duration) *Limiter {
+	return &Limiter{n: n, per: per, buckets: map[string]*Bucket{}, pruned: time.Now()}
+}
+
+// Allow takes a token from the key's bucket if there is one left.
+func (l *Limiter) Allow(key string) bool {
+	if unlimited(l.n, l.per) {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.pruned) > l.per {
+		// Buckets that filled up again are the same as new ones, forget them.
+		for otherKey, bucket := range l.buckets {
+			bucket.refill(now)
+			if bucket.tokens >= bucket.capacity {
+				delete(l.buckets, otherKey)
+			}
+		}
+		l.pruned = now
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.n, l.per)
+		l.buckets[key] = bucket
+	}
+	return bucket.Allow()
+}
+
+// RetryAfter returns how long a key that was refused should wait before it earns a token back, at most.
+func (l *Limiter) RetryAfter() time.Duration {
+	if unlimited(l.n, l.per) {
+		return 0
+	}
+	return l.per / time.Duration(l.n)
+}
+
+// Middleware refuses requests whose key ran out of tokens with 429 Too Many Requests and a Retry-After header.
+func (l *Limiter) Middleware(key func(r *http.Request) string, next utils.Handler) utils.Handler {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(key(r)) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(l.RetryAfter().Seconds()))))
+			utils.WriteError(w, http.StatusTooManyRequests, ErrLimited.Error(), "Too many requests, try again later")
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		per     time.Duration
+		keys    []string
+		allowed []bool
+	}{
+		{"within the limit", 2, time.Hour, []string{"a", "a"}, []bool{true, true}},
+		{"over the limit", 2, time.Hour, []string{"a", "a", "a"}, []bool{true, true, false}},
+		{"keys don't share tokens", 1, time.Hour, []string{"a", "b", "a", "b"}, []bool{true, true, false, false}},
+		{"no tokens means no limit", 0, time.Hour, []string{"a", "a", "a"}, []bool{true, true, true}},
+		{"no period means no limit", 1, 0, []string{"a", "a"}, []bool{true, true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New(test.n, test.per)
+			for i, key := range test.keys {
+				if got := limiter.Allow(key); got != test.allowed[i] {
+					t.Errorf("request %d of %s allowed: %v, want %v", i+1, key, got, test.allowed[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBucketRefills(t *testing.T) {
+	bucket := NewBucket(2, time.Minute)
+	bucket.Allow()
+	bucket.Allow()
+	if bucket.Allow() {
+		t.Fatal("an empty bucket allowed a request")
+	}
+	bucket.last = bucket.last.Add(-30 * time.Second)
+	if !bucket.Allow() {
+		t.Error("the bucket didn't earn a token back")
+	}
+	if bucket.Allow() {
+		t.Error("the bucket earned more tokens than it should")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := New(1, time.Minute)
+	handler := limiter.Middleware(func(r *http.Request) string { return "key" }, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	tests := []struct {
+		status     int
+		retryAfter string
+	}{
+		{http.StatusNoContent, ""},
+		{http.StatusTooManyRequests, "60"},
+	}
+	for i, test := range tests {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		if recorder.Code != test.status || recorder.Header().Get("Retry-After") != test.retryAfter {
+			t.Errorf("request %d: status %d, Retry-After %q, want %d and %q", i+1, recorder.Code, recorder.Header().Get("Retry-After"), test.status, test.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+)
+
+// Errors returned when a token can't be trusted.
+var (
+	ErrInvalidToken = errors.New("InvalidToken")
+	ErrTokenExpired = errors.New("TokenExpired")
+)
+
+// Claims what a token proves about the player holding it
+type Claims struct {
+	GameID    string `json:"gid"`
+	PlayerID  string `json:"pid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var (
+	secretOnce sync.Once
+	secretKey  []byte
+)
+
+// secret returns the key tokens are signed with. It is read from the TOKEN_SECRET environment variable or
+// ./token-secret.txt. Without either a random key is used, which means tokens stop working on restart.
+func secret() []byte {
+	secretOnce.Do(func() {
+		if key := os.Getenv("TOKEN_SECRET"); key != "" {
+			secretKey = []byte(key)
+			return
+		}
+		if key, err := ioutil.ReadFile("./token-secret.txt"); err == nil && len(strings.TrimSpace(string(key))) > 0 {
+			secretKey = []byte(strings.TrimSpace(string(key)))
+			return
+		}
+		log.Println("No token secret configured, player tokens will not survive a restart")
+		secretKey = make([]byte, 32)
+		if _, err := rand.Read(secretKey); err != nil {
+			log.Fatal(err)
+		}
+	})
+	return secretKey
+}
+
+func sign(payload string) string {
+	mac := hmac.New(sha256.New, secret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// trustClaims what a trust token proves: the browser holding it passed a captcha recently, from the same
+// address and with the same user agent.
+type trustClaims struct {
+	Kind      string `json:"kind"`
+	Client    string `json:"cid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+const kindTrust = "trust"
+
+// encode signs the JSON encoding of claims.
+func encode(claims interface{}) (string, error) {
+	encoded, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(encoded)
+	return payload + "." + sign(payload), nil
+}
+
+// decode checks the signature of a token and decodes its claims.
+func decode(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(sign(parts[0]))) {
+		return ErrInvalidToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(decoded, claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// Issue returns a token proving the holder is the given player of the given game.
+func Issue(gameID string, playerID string) (string, error) {
+	return encode(Claims{GameID: gameID, PlayerID: playerID, ExpiresAt: time.Now().Add(config.TokenTTL()).Unix()})
+}
+
+// Verify checks the signature and expiry of a token and returns its claims.
+func Verify(token string) (*Claims, error) {
+	var claims Claims
+	if err := decode(token, &claims); err != nil {
+		return nil, err
+	}
+	if claims.GameID == "" || claims.PlayerID == "" {
+		return nil, ErrInvalidToken
+	}
+	if claims.ExpiresAt < time.Now().Unix() {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// clientBinding identifies the client a trust token was issued to without putting its address in the token.
+func clientBinding(ip string, userAgent string) string {
+	return sign("client\x00" + ip + "\x00" + userAgent)
+}
+
+// IssueTrust returns a token proving the holder passed a captcha, so they aren't asked again for a while. It is
+// only good for requests from the given IP and user agent.
+func IssueTrust(ip string, userAgent string) (string, error) {
+	return encode(trustClaims{Kind: kindTrust, Client: clientBinding(ip, userAgent), ExpiresAt: time.Now().Add(config.TrustTTL()).Unix()})
+}
+
+// VerifyTrust checks the signature and expiry of a trust token, and that it was issued to the given IP and
+// user agent.
+func VerifyTrust(token string, ip string, userAgent string) error {
+	var claims trustClaims
+	if err := decode(token, &claims); err != nil {
+		return err
+	}
+	if claims.Kind != kindTrust || !hmac.Equal([]byte(claims.Client), []byte(clientBinding(ip, userAgent))) {
+		return ErrInvalidToken
+	}
+	if claims.ExpiresAt < time.Now().Unix() {
+		return ErrTokenExpired
+	}
+	return nil
+}
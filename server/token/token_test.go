@@ -0,0 +1,34 @@
+package token
+
+import "testing"
+
+func TestVerifyTrust(t *testing.T) {
+	trust, err := IssueTrust("203.0.113.7", "Firefox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, err := Issue("game", "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		token     string
+		ip        string
+		userAgent string
+		want      error
+	}{
+		{"same client", trust, "203.0.113.7", "Firefox", nil},
+		{"other IP", trust, "198.51.100.1", "Firefox", ErrInvalidToken},
+		{"other user agent", trust, "203.0.113.7", "curl", ErrInvalidToken},
+		{"tampered", trust + "x", "203.0.113.7", "Firefox", ErrInvalidToken},
+		{"player token", player, "203.0.113.7", "Firefox", ErrInvalidToken},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := VerifyTrust(test.token, test.ip, test.userAgent); err != test.want {
+				t.Errorf("VerifyTrust = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
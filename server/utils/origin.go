@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+)
+
+// AllowedOrigin reports whether the request may be served given where it came from. Requests without an Origin
+// header don't come from a web page (e.g. bots using apiclient) and are allowed, as are pages of the server itself
+// and of the sites in config.AllowedOrigins.
+func AllowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameOrigin(r, origin) {
+		return true
+	}
+	for _, allowed := range config.AllowedOrigins() {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// CORS refuses requests from pages of sites that aren't allowed with 403 OriginNotAllowed, lets the allowed ones
+// read responses and send cookies, answers their preflight requests, and keeps other sites from framing the app.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Set("Content-Security-Policy", frameAncestors())
+		origin := r.Header.Get("Origin")
+		if origin == "" || sameOrigin(r, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !AllowedOrigin(r) {
+			WriteError(w, http.StatusForbidden, "OriginNotAllowed", "This site may not use the API")
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// frameAncestors returns the policy that lets only the server itself and the allowed sites put the app in a frame.
+func frameAncestors() string {
+	sources := append([]string{"'self'"}, config.AllowedOrigins()...)
+	return "frame-ancestors " + strings.Join(sources, " ")
+}
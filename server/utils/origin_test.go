@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// setAllowedOrigins sets ALLOWED_ORIGINS for one test and returns a function that puts it back.
+func setAllowedOrigins(t *testing.T, origins string) func() {
+	old, had := os.LookupEnv("ALLOWED_ORIGINS")
+	if err := os.Setenv("ALLOWED_ORIGINS", origins); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if had {
+			os.Setenv("ALLOWED_ORIGINS", old)
+		} else {
+			os.Unsetenv("ALLOWED_ORIGINS")
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     string
+		origin      string
+		wantStatus  int
+		wantAllowed string
+	}{
+		{"no Origin header", "", "", http.StatusOK, ""},
+		{"same origin", "", "http://example.com", http.StatusOK, ""},
+		{"other site", "", "https://evil.example", http.StatusForbidden, ""},
+		{"wildcard", "*", "https://evil.example", http.StatusOK, "https://evil.example"},
+		{"exact match", "https://codenames.example", "https://codenames.example", http.StatusOK, "https://codenames.example"},
+		{"trailing slash in config", "https://codenames.example/", "https://codenames.example", http.StatusOK, "https://codenames.example"},
+		{"one of several", "https://a.example, https://codenames.example", "https://codenames.example", http.StatusOK, "https://codenames.example"},
+		{"scheme mismatch", "https://codenames.example", "http://codenames.example", http.StatusForbidden, ""},
+		{"port mismatch", "https://codenames.example", "https://codenames.example:8443", http.StatusForbidden, ""},
+		{"subdomain", "https://codenames.example", "https://evil.codenames.example", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setAllowedOrigins(t, test.allowed)()
+			r := httptest.NewRequest("GET", "http://example.com/game/list", nil)
+			if test.origin != "" {
+				r.Header.Set("Origin", test.origin)
+			}
+			if got, want := AllowedOrigin(r), test.wantStatus == http.StatusOK; got != want {
+				t.Errorf("AllowedOrigin %v, want %v", got, want)
+			}
+			w := httptest.NewRecorder()
+			CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			if w.Code != test.wantStatus {
+				t.Errorf("status %d, want %d", w.Code, test.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != test.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, test.wantAllowed)
+			}
+			if test.wantAllowed != "" && w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Error("credentials not allowed for an allowed origin")
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	defer setAllowedOrigins(t, "https://codenames.example")()
+	r := httptest.NewRequest("OPTIONS", "http://example.com/game/join", nil)
+	r.Header.Set("Origin", "https://codenames.example")
+	r.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("preflight request reached the handler")
+	})).ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Authorization, Content-Type" {
+		t.Errorf("Access-Control-Allow-Headers %q", got)
+	}
+}
+
+func TestFrameAncestors(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		want    string
+	}{
+		{"server only", "", "frame-ancestors 'self'"},
+		{"allowed sites", "https://a.example, https://b.example/", "frame-ancestors 'self' https://a.example https://b.example"},
+		{"wildcard", "*", "frame-ancestors 'self' *"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer setAllowedOrigins(t, test.allowed)()
+			r := httptest.NewRequest("GET", "http://example.com/", nil)
+			r.Header.Set("Origin", "https://evil.example")
+			w := httptest.NewRecorder()
+			CORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Security-Policy"); got != test.want {
+				t.Errorf("Content-Security-Policy %q, want %q", got, test.want)
+			}
+		})
+	}
+}
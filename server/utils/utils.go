@@ -1,59 +1,64 @@
 package utils
 
 import (
+	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
-	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 
+	"github.com/RobertDHanna/OpenCodenames/config"
 	"github.com/gorilla/websocket"
 )
 
-const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
-
 // Handler type for HTTP handlers
 type Handler func(w http.ResponseWriter, r *http.Request)
 
 // WSHandler type for WebSocket handlers
 type WSHandler func(r *http.Request, c *websocket.Conn)
 
-// MakeEasyID creates an ID composed of random alphabetic characters
-func MakeEasyID(length int) (string, error) {
-	if length < 1 {
-		return "", errors.New("cannot pass in length < 1")
-	}
-	var id strings.Builder
-	for i := 0; i < length; i++ {
-		randomIndex := rand.Intn(len(alphabet))
-		character := string(alphabet[randomIndex])
-		id.WriteString(character)
+// APIError the body of every failed API request, e.g. {"error":{"code":"GameIsFull","message":"..."}}
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WriteJSON writes v as the JSON body of a response with the given status code.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("WriteJSON: Could not encode response", err)
 	}
-	return id.String(), nil
 }
 
-// PostRequest wraps a POST request handler
-func PostRequest(handler Handler) Handler {
+// WriteError writes an error envelope with the given status code.
+func WriteError(w http.ResponseWriter, status int, code string, message string) {
+	WriteJSON(w, status, map[string]APIError{"error": {Code: code, Message: message}})
+}
+
+// methodRequest wraps a handler that only accepts the given HTTP method
+func methodRequest(method string, handler Handler) Handler {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			fmt.Fprintf(w, "Invalid HTTP method")
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			WriteError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "Use "+method+" for this endpoint")
 			return
 		}
 		handler(w, r)
 	}
 }
 
+// PostRequest wraps a POST request handler
+func PostRequest(handler Handler) Handler {
+	return methodRequest(http.MethodPost, handler)
+}
+
 // GetRequest wraps a GET request handler
 func GetRequest(handler Handler) Handler {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			fmt.Fprintf(w, "Invalid HTTP method")
-			return
-		}
-		handler(w, r)
-	}
+	return methodRequest(http.MethodGet, handler)
 }
 
 // WebSocketRequest wraps a WebSocket request handler
@@ -61,10 +66,7 @@ func WebSocketRequest(handle WSHandler) Handler {
 	upgrader := websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-	}
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		// TODO: actually check the origin.
-		return true
+		CheckOrigin:     AllowedOrigin,
 	}
 	return func(w http.ResponseWriter, r *http.Request) {
 		c, err := upgrader.Upgrade(w, r, nil)
@@ -95,11 +97,49 @@ func GetQueryValue(params *url.Values, paramName string) (string, error) {
 	return paramValueArray[0], nil
 }
 
-// GetIP implementation borrowed from https://golangcode.com/get-the-request-ip-addr/
+// GetIP returns the IP of the client that sent the request. X-Forwarded-For is only believed when the request came
+// from one of config.TrustedProxies, and then only up to the first address that isn't a trusted proxy itself, since
+// everything to its left was written by the client.
 func GetIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-FORWARDED-FOR")
-	if forwarded != "" {
-		return forwarded
+	return clientIP(r, config.TrustedProxies())
+}
+
+// clientIP is GetIP with the given trusted proxies.
+func clientIP(r *http.Request, proxies []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !trusted(ip, proxies) {
+		return ip
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !trusted(hop, proxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// trusted reports whether ip belongs to one of the proxies.
+func trusted(ip string, proxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, proxy := range proxies {
+		if proxy.Contains(parsed) {
+			return true
+		}
 	}
-	return r.RemoteAddr
+	return false
 }
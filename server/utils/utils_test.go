@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RobertDHanna/OpenCodenames/config"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"no proxies", "", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"untrusted proxy", "", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.0/8", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hops", "10.0.0.0/8", "10.1.2.3:4000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "10.0.0.0/8, 192.0.2.1", "10.1.2.3:4000", []string{"198.51.100.1, 192.0.2.1", "10.9.9.9"}, "198.51.100.1"},
+		{"garbage hop", "10.0.0.0/8", "10.1.2.3:4000", []string{"1.2.3.4, nonsense"}, "10.1.2.3"},
+		{"only proxies", "10.0.0.0/8", "10.1.2.3:4000", []string{"10.4.5.6"}, "10.4.5.6"},
+		{"IPv6", "2001:db8::1", "[2001:db8::1]:4000", []string{"2001:db8::2"}, "2001:db8::2"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for _, header := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", header)
+			}
+			if got := clientIP(r, config.ParseProxies(test.proxies)); got != test.want {
+				t.Errorf("client IP %q, want %q", got, test.want)
+			}
+		})
+	}
+}